@@ -19,6 +19,7 @@ func GetGetCommand() *cobra.Command {
 	}
 
 	cmd.Flags().BoolP("stay", "s", false, "Stay connected and write changes to stdout")
+	addBytesFlag(cmd)
 	cmd.Args = cobra.ExactArgs(1)
 
 	return cmd
@@ -37,18 +38,23 @@ func runGet(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := readBytesFlag(cmd); err != nil {
+		return err
+	}
+
 	group, err := surp.JoinGroup(env.Interface, env.Group, false)
 	if err != nil {
 		return err
 	}
 
-	values := make(chan surp.Optional[any])
+	values := make(chan string)
+
+	var register *consumer.Register[any]
+	register = consumer.NewAnyRegister(name, func(value surp.Optional[any]) {
+		values <- prettyFormatValue(value, register.GetMetadata().GetOrDefault(nil))
+	})
 
-	group.AddConsumers(
-		consumer.NewAnyRegister(name, func(value surp.Optional[any]) {
-			values <- value
-		}),
-	)
+	group.AddConsumers(register)
 
 	if stay {
 
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	surp "github.com/burgrp/surp-go/pkg"
@@ -23,6 +24,8 @@ func GetListCommand() *cobra.Command {
 	cmd.Flags().DurationP("timeout", "t", surp.SyncTimeout, "Timeout for waiting for the registers")
 	cmd.Flags().BoolP("values", "v", false, "Do not print values")
 	cmd.Flags().BoolP("meta", "m", false, "Do not print metadata")
+	cmd.Flags().BoolP("units", "u", false, "Print units after values")
+	addBytesFlag(cmd)
 
 	return cmd
 }
@@ -66,37 +69,49 @@ func runList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	units, err := cmd.Flags().GetBool("units")
+	if err != nil {
+		return err
+	}
+
+	if err := readBytesFlag(cmd); err != nil {
+		return err
+	}
+
 	group, err := surp.JoinGroup(env.Interface, env.Group, true)
 	if err != nil {
 		return err
 	}
 
 	allSynced := make(map[string]struct{})
+	var mutex sync.Mutex
 
 	group.OnSync(func(message *surp.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
 		name := message.Name
 		_, synced := allSynced[name]
 		if passNameFilter(name, args) && (!synced || stay) {
-			typ := message.Metadata["type"]
-			var value surp.Optional[any]
-			if message.Value.IsDefined() {
-				v, ok := surp.DecodeGeneric(message.Value.Get(), typ)
-				if !ok {
-					return
-				}
-				value = surp.NewDefined[any](v)
+			metadata := surp.Metadata(message.Metadata)
+			value, ok := decodeValue(message.Value, metadata)
+			if !ok {
+				return
 			}
 			valueStr := ""
 			if !noValues {
-				valueStr = fmt.Sprintf("=%s", value.String())
+				valueStr = fmt.Sprintf("=%s", formatValue(value, metadata))
+				if unit := metadata.Unit(); units && unit != "" && value.IsDefined() {
+					valueStr += " " + unit
+				}
 			}
 			metaStr := ""
 			if !noMeta {
-				for k, v := range message.Metadata {
+				for _, k := range metadata.Keys() {
 					if metaStr != "" {
 						metaStr += " "
 					}
-					metaStr += fmt.Sprintf("%s:%s", k, v)
+					metaStr += fmt.Sprintf("%s:%s", k, metadata[k])
 				}
 				metaStr = " \t[" + metaStr + "]"
 			}
@@ -19,11 +19,14 @@ func GetProvideCommand() *cobra.Command {
 		Short: "Provide a register",
 		Long: `Provides a register with the specified name, value and metadata.
 Subsequent values are read from stdin and are written to stdout.
-Default type is int, if not specified otherwise in metadata.`,
+Default type is int, if not specified otherwise in metadata.
+Enum registers list their symbols in metadata, e.g. surp provide mode off type:enum enum:off,auto,manual.`,
 		RunE: runProvide,
 	}
 
 	cmd.Flags().BoolP("read-only", "r", false, "Make the register read-only.")
+	cmd.Flags().StringP("persist", "p", "", "File to store values set over the network in, the stored value overrides the given one on start.")
+	addBytesFlag(cmd)
 	cmd.Args = cobra.MinimumNArgs(2)
 
 	return cmd
@@ -52,28 +55,58 @@ func runProvide(cmd *cobra.Command, args []string) error {
 	if t, ok := metadata["type"]; ok {
 		typ = t
 	}
+	metadata["type"] = typ
+
+	if err := surp.Metadata(metadata).Validate(); err != nil {
+		return err
+	}
 
 	ro, err := cmd.Flags().GetBool("read-only")
 	if err != nil {
 		return err
 	}
 
+	persist, err := cmd.Flags().GetString("persist")
+	if err != nil {
+		return err
+	}
+
+	if err := readBytesFlag(cmd); err != nil {
+		return err
+	}
+
 	group, err := surp.JoinGroup(env.Interface, env.Group, false)
 	if err != nil {
 		return err
 	}
 
-	value, err := parseString(valueStr, typ)
+	group.OnSendError(func(message *surp.Message, err error) {
+		println("failed to send", message.Name+":", err.Error())
+	})
+
+	value, err := parseString(valueStr, metadata)
 	if err != nil {
 		return err
 	}
 
 	var pro *provider.Register[any]
 	pro = provider.NewAnyRegister(name, value, typ, !ro, metadata, func(value surp.Optional[any]) {
-		pro.SyncValue(value)
-		fmt.Println(value)
+		if err := pro.SyncValue(value); err != nil {
+			println(err.Error())
+			return
+		}
+		fmt.Println(formatValue(value, metadata))
 	})
 
+	if persist != "" {
+		// values are written on every set, since the command is usually ended by a signal
+		store, err := surp.OpenFileStore(persist, 0)
+		if err != nil {
+			return err
+		}
+		pro.Persist(reportingStore{store})
+	}
+
 	err = group.AddProviders(pro)
 	if err != nil {
 		return err
@@ -82,11 +115,13 @@ func runProvide(cmd *cobra.Command, args []string) error {
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		v := scanner.Text()
-		value, err = parseString(v, typ)
+		value, err = parseString(v, metadata)
 		if err != nil {
 			println(err.Error())
 		}
-		pro.SyncValue(value)
+		if err := pro.SyncValue(value); err != nil {
+			println(err.Error())
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		return err
@@ -95,3 +130,16 @@ func runProvide(cmd *cobra.Command, args []string) error {
 	return nil
 
 }
+
+// Prints errors of saves, which the register does not report.
+type reportingStore struct {
+	surp.Store
+}
+
+func (store reportingStore) Save(name string, value surp.Optional[[]byte]) error {
+	err := store.Store.Save(name, value)
+	if err != nil {
+		println("failed to store value:", err.Error())
+	}
+	return err
+}
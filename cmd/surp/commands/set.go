@@ -3,9 +3,7 @@ package commands
 import (
 	"bufio"
 	"errors"
-	"fmt"
 	"os"
-	"strconv"
 	"time"
 
 	surp "github.com/burgrp/surp-go/pkg"
@@ -26,45 +24,12 @@ Values are specified as JSON expressions, e.g. true, false, 3.14, "hello world"
 
 	cmd.Flags().BoolP("stay", "s", false, "Stay connected, read values from stdin and write changes to stdout")
 	cmd.Flags().DurationP("timeout", "o", surp.SyncTimeout, "Timeout for waiting for the register to be set")
+	addBytesFlag(cmd)
 	cmd.Args = cobra.ExactArgs(2)
 
 	return cmd
 }
 
-func parseString(value string, typ string) (surp.Optional[any], error) {
-
-	var undefined surp.Optional[any]
-
-	if value == "null" {
-		return undefined, nil
-	}
-
-	switch typ {
-	case "string":
-		return surp.NewDefined(any(value)), nil
-	case "int":
-		v, err := strconv.ParseInt(value, 10, 64)
-		if err != nil {
-			return undefined, err
-		}
-		return surp.NewDefined(any(v)), nil
-	case "float":
-		v, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return undefined, err
-		}
-		return surp.NewDefined(any(v)), nil
-	case "bool":
-		v, err := strconv.ParseBool(value)
-		if err != nil {
-			return undefined, err
-		}
-		return surp.NewDefined(any(v)), nil
-	default:
-		return undefined, fmt.Errorf("unsupported type: %s", typ)
-	}
-}
-
 func setRegisterValue(register *consumer.Register[any], desired string, timeout time.Duration, syncs chan surp.Optional[any]) error {
 	to := time.After(timeout)
 
@@ -75,19 +40,22 @@ Wait:
 			return errors.New("timeout waiting for register to be set")
 		case actual := <-syncs:
 			if register.GetMetadata().IsDefined() {
-				typ := register.GetMetadata().Get()["type"]
-				if typ != "" {
-					des, err := parseString(desired, typ)
+				metadata := register.GetMetadata().Get()
+				if metadata["type"] != "" {
+					des, err := parseString(desired, metadata)
 					if err != nil {
 						return err
 					}
 
-					if actual == des {
+					if equalValues(actual, des, metadata) {
 						println(desired)
 						break Wait
 					}
 
-					register.SetValue(des)
+					err = register.SetValue(des)
+					if err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -109,6 +77,10 @@ func runSet(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := readBytesFlag(cmd); err != nil {
+		return err
+	}
+
 	timeout, error := cmd.Flags().GetDuration("timeout")
 	if error != nil {
 		return error
@@ -127,13 +99,19 @@ func runSet(cmd *cobra.Command, args []string) error {
 
 	group.AddConsumers(register)
 
-	setRegisterValue(register, args[1], timeout, syncs)
+	err = setRegisterValue(register, args[1], timeout, syncs)
+	if err != nil {
+		return err
+	}
 
 	if stay {
 		scanner := bufio.NewScanner(os.Stdin)
 		for scanner.Scan() {
 			v := scanner.Text()
-			setRegisterValue(register, v, timeout, syncs)
+			err = setRegisterValue(register, v, timeout, syncs)
+			if err != nil {
+				println(err.Error())
+			}
 		}
 		if err := scanner.Err(); err != nil {
 			return err
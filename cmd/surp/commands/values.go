@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	surp "github.com/burgrp/surp-go/pkg"
+	"github.com/spf13/cobra"
+)
+
+// Text representation of bytes values, hex or base64.
+var bytesFormat = "hex"
+
+func addBytesFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("bytes", "b", "hex", "Representation of bytes values: hex or base64")
+}
+
+func readBytesFlag(cmd *cobra.Command) error {
+	format, err := cmd.Flags().GetString("bytes")
+	if err != nil {
+		return err
+	}
+	if format != "hex" && format != "base64" {
+		return fmt.Errorf("unsupported bytes representation: %s", format)
+	}
+	bytesFormat = format
+	return nil
+}
+
+func resolveCodec(metadata map[string]string) (*surp.Codec, error) {
+	codec, err := surp.ResolveCodec(metadata)
+	if err != nil || metadata["type"] != "bytes" || bytesFormat != "base64" {
+		return codec, err
+	}
+	return &surp.Codec{
+		Encode: codec.Encode,
+		Decode: codec.Decode,
+		Parse: func(s string) (any, error) {
+			return base64.StdEncoding.DecodeString(s)
+		},
+		Format: func(v any) string {
+			b, ok := v.([]byte)
+			if !ok {
+				return codec.Format(v)
+			}
+			return base64.StdEncoding.EncodeToString(b)
+		},
+	}, nil
+}
+
+func parseString(value string, metadata map[string]string) (surp.Optional[any], error) {
+
+	var undefined surp.Optional[any]
+
+	if value == "null" {
+		return undefined, nil
+	}
+
+	codec, err := resolveCodec(metadata)
+	if err != nil {
+		return undefined, err
+	}
+
+	// values are JSON expressions, so quoted strings are accepted for any type
+	typ := metadata["type"]
+	if typ != "json" && typ != "cbor" && strings.HasPrefix(value, "\"") {
+		var unquoted string
+		if err := json.Unmarshal([]byte(value), &unquoted); err == nil {
+			value = unquoted
+		}
+	}
+
+	v, err := codec.Parse(value)
+	if err != nil {
+		return undefined, err
+	}
+
+	return surp.NewDefined(v), nil
+}
+
+func decodeValue(value surp.Optional[[]byte], metadata map[string]string) (surp.Optional[any], bool) {
+
+	var undefined surp.Optional[any]
+
+	if value.IsUndefined() {
+		return undefined, true
+	}
+
+	codec, err := resolveCodec(metadata)
+	if err != nil {
+		return undefined, false
+	}
+
+	v, ok := codec.Decode(value.Get())
+	if !ok {
+		return undefined, false
+	}
+
+	return surp.NewDefined(v), true
+}
+
+func formatValue(value surp.Optional[any], metadata map[string]string) string {
+	if value.IsUndefined() {
+		return value.String()
+	}
+	if precision := surp.Metadata(metadata).Precision(); precision.IsDefined() {
+		switch f := value.Get().(type) {
+		case float64:
+			return strconv.FormatFloat(f, 'f', precision.Get(), 64)
+		case float32:
+			return strconv.FormatFloat(float64(f), 'f', precision.Get(), 32)
+		}
+	}
+	codec, err := resolveCodec(metadata)
+	if err != nil {
+		return value.String()
+	}
+	return codec.Format(value.Get())
+}
+
+func prettyFormatValue(value surp.Optional[any], metadata map[string]string) string {
+	formatted := formatValue(value, metadata)
+	typ := metadata["type"]
+	if (typ == "json" || typ == "cbor" || typ == "struct") && value.IsDefined() {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(formatted), "", "  "); err == nil {
+			return buf.String()
+		}
+	}
+	return formatted
+}
+
+// Compares values by their encoded form, since values of some types (e.g. json) are not comparable by ==.
+func equalValues(a surp.Optional[any], b surp.Optional[any], metadata map[string]string) bool {
+	codec, err := resolveCodec(metadata)
+	if err != nil {
+		return false
+	}
+	return surp.EqualOptional(a, b, surp.EqualEncoded(codec.Encode))
+}
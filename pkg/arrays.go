@@ -0,0 +1,192 @@
+package surp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Suffix of array type names, e.g. "int[]" is an array of "int" elements.
+const ArrayTypeSuffix = "[]"
+
+/*
+Array Encoding (Binary):
+
+	Elements of fixed size types are concatenated, the element count is given by the value length.
+	Elements of variable size types (e.g. string) are each prefixed by their length as unsigned varint.
+*/
+
+func EncodeArray[T any](v []T, elemType string) ([]byte, error) {
+	return EncodeGeneric(v, elemType+ArrayTypeSuffix)
+}
+
+func DecodeArray[T any](b []byte, elemType string) ([]T, bool) {
+	v, ok := DecodeGeneric(b, elemType+ArrayTypeSuffix)
+	if !ok {
+		return nil, false
+	}
+	result, ok := v.([]T)
+	return result, ok
+}
+
+// Sizes of encoded values of fixed size types, other types are considered variable size.
+var fixedSizes = map[string]int{
+	"int":      8,
+	"bool":     1,
+	"float":    8,
+	"int8":     1,
+	"int16":    2,
+	"int32":    4,
+	"uint8":    1,
+	"uint16":   2,
+	"uint32":   4,
+	"uint64":   8,
+	"float32":  4,
+	"time":     8,
+	"duration": 8,
+}
+
+// Writes encoded element of a composite value, variable size elements are prefixed by their length.
+func writeElement(buf *bytes.Buffer, encoded []byte, size int) {
+	if size == 0 {
+		buf.Write(binary.AppendUvarint(nil, uint64(len(encoded))))
+	}
+	buf.Write(encoded)
+}
+
+func readElement(remaining *[]byte, size int) ([]byte, bool) {
+	b := *remaining
+	n := size
+	if size == 0 {
+		length, read := binary.Uvarint(b)
+		if read <= 0 || length > uint64(len(b)-read) {
+			return nil, false
+		}
+		b = b[read:]
+		n = int(length)
+	}
+	if len(b) < n {
+		return nil, false
+	}
+	*remaining = b[n:]
+	return b[:n], true
+}
+
+func registerArrayCodec[T any](elemType string) {
+
+	typ := elemType + ArrayTypeSuffix
+	size := fixedSizes[elemType]
+
+	elemCodec := func() *Codec {
+		codec, _ := GetCodec(elemType)
+		return codec
+	}
+
+	RegisterCodec(typ, func(v any) ([]byte, error) {
+
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, typeError(v, typ)
+		}
+
+		var buf bytes.Buffer
+		for i := 0; i < rv.Len(); i++ {
+			encoded, err := elemCodec().Encode(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			writeElement(&buf, encoded, size)
+		}
+		return buf.Bytes(), nil
+
+	}, func(b []byte) (any, bool) {
+
+		result := []T{}
+		for len(b) > 0 {
+			encoded, ok := readElement(&b, size)
+			if !ok {
+				return nil, false
+			}
+			elem, ok := elemCodec().Decode(encoded)
+			if !ok {
+				return nil, false
+			}
+			// element codec may be replaced by one decoding other type
+			v, ok := elem.(T)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, v)
+		}
+		return result, true
+
+	}, func(s string) (any, error) {
+
+		var raw []json.RawMessage
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return nil, fmt.Errorf("%s value must be a JSON array: %w", typ, err)
+		}
+
+		result := make([]T, 0, len(raw))
+		for _, r := range raw {
+			str := string(r)
+			var unquoted string
+			if json.Unmarshal(r, &unquoted) == nil {
+				str = unquoted
+			}
+			elem, err := elemCodec().Parse(str)
+			if err != nil {
+				return nil, err
+			}
+			v, ok := elem.(T)
+			if !ok {
+				return nil, fmt.Errorf("%s element %v is %T", typ, elem, elem)
+			}
+			result = append(result, v)
+		}
+		return result, nil
+
+	}, func(v any) string {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return formatAny(v)
+		}
+
+		// elements are marshalled one by one, since []uint8 would be marshalled as base64
+		elems := make([]json.RawMessage, rv.Len())
+		for i := range elems {
+			elem := rv.Index(i).Interface()
+			// e.g. durations are rendered as "1.5s" instead of nanoseconds
+			if _, ok := elem.(fmt.Stringer); ok {
+				elem = elemCodec().Format(elem)
+			}
+			b, err := json.Marshal(elem)
+			if err != nil {
+				return formatAny(v)
+			}
+			elems[i] = b
+		}
+		b, _ := json.Marshal(elems)
+		return string(b)
+	})
+}
+
+func init() {
+	registerArrayCodec[string]("string")
+	registerArrayCodec[int64]("int")
+	registerArrayCodec[bool]("bool")
+	registerArrayCodec[float64]("float")
+	registerArrayCodec[int8]("int8")
+	registerArrayCodec[int16]("int16")
+	registerArrayCodec[int32]("int32")
+	registerArrayCodec[uint8]("uint8")
+	registerArrayCodec[uint16]("uint16")
+	registerArrayCodec[uint32]("uint32")
+	registerArrayCodec[uint64]("uint64")
+	registerArrayCodec[float32]("float32")
+	registerArrayCodec[time.Time]("time")
+	registerArrayCodec[time.Duration]("duration")
+}
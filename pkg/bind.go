@@ -0,0 +1,287 @@
+package surp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+/*
+Binding keeps fields of a Go struct synchronized with registers of a group.
+
+Registers are created for exported fields with surp tag:
+
+	Setpoint float64 `surp:"setpoint,rw,unit=°C"`
+	Actual   float64 `surp:"actual,unit=°C"`
+	Outdoor  float64 `surp:"outdoor,consume"`
+
+The first tag item is register name, followed by flags and options:
+  - rw: the register is writable over the network
+  - consume: the field is bound to a register of another device instead of being provided
+  - type=<type>: register type, inferred from the Go type by default
+  - other options are advertised as register metadata (e.g. unit=°C)
+
+Fields must be accessed under Lock/Unlock, since they are updated from the network.
+Changes of provided fields are synced on Commit, changes of consumed fields are sent as sets.
+*/
+type Binding struct {
+	target         reflect.Value
+	fields         []*boundField
+	changeListener func(string)
+	mutex          sync.Mutex
+}
+
+type boundField struct {
+	binding  *Binding
+	name     string
+	index    []int
+	codec    *Codec
+	metadata map[string]string
+	rw       bool
+
+	// encoded value last synced or committed
+	last Optional[[]byte]
+
+	// syncs provided field or sets consumed field, attached by the group
+	notify func(Optional[[]byte])
+}
+
+type boundProvider struct {
+	*boundField
+}
+
+type boundConsumer struct {
+	*boundField
+}
+
+// Binds tagged fields of the struct pointed to by target to registers of the group.
+func Bind(group *RegisterGroup, target any) (*Binding, error) {
+
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("binding target must be a pointer to struct")
+	}
+
+	binding := &Binding{
+		target: rv.Elem(),
+	}
+
+	var providers []Provider
+	var consumers []Consumer
+
+	t := binding.target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag, ok := f.Tag.Lookup("surp")
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+
+		name, flags, options := parseTag(tag)
+		if name == "" {
+			name = f.Name
+		}
+
+		typ := options["type"]
+		if typ == "" {
+			typ, ok = typeNameOf(f.Type)
+			if !ok {
+				return nil, fmt.Errorf("unsupported type %s of field %s", f.Type, f.Name)
+			}
+		}
+
+		metadata := map[string]string{}
+		for k, v := range options {
+			metadata[k] = v
+		}
+		metadata["type"] = typ
+		metadata["rw"] = fmt.Sprintf("%t", flags["rw"])
+
+		codec, err := ResolveCodec(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+
+		field := &boundField{
+			binding:  binding,
+			name:     name,
+			index:    f.Index,
+			codec:    codec,
+			metadata: metadata,
+			rw:       flags["rw"],
+		}
+
+		field.last, err = field.encode()
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+
+		binding.fields = append(binding.fields, field)
+
+		if flags["consume"] {
+			consumers = append(consumers, &boundConsumer{boundField: field})
+		} else {
+			providers = append(providers, &boundProvider{boundField: field})
+		}
+	}
+
+	// registers added before a failure are removed, so that a failed binding does not keep syncing
+	if err := group.AddProviders(providers...); err != nil {
+		group.removeProviders(providers...)
+		return nil, err
+	}
+
+	if err := group.AddConsumers(consumers...); err != nil {
+		group.removeProviders(providers...)
+		group.removeConsumers(consumers...)
+		return nil, err
+	}
+
+	return binding, nil
+}
+
+// Locks the bound struct for reading or modification.
+func (binding *Binding) Lock() {
+	binding.mutex.Lock()
+}
+
+func (binding *Binding) Unlock() {
+	binding.mutex.Unlock()
+}
+
+// Registers listener called with register name whenever a field is updated from the network.
+// The listener is called without the lock held.
+func (binding *Binding) OnChange(listener func(name string)) {
+	binding.mutex.Lock()
+	defer binding.mutex.Unlock()
+	binding.changeListener = listener
+}
+
+// Syncs provided fields and sets consumed fields changed since the last commit.
+func (binding *Binding) Commit() error {
+
+	var notify []func()
+
+	binding.mutex.Lock()
+	for _, field := range binding.fields {
+		encoded, err := field.encode()
+		if err != nil {
+			binding.mutex.Unlock()
+			return fmt.Errorf("field %s: %w", field.name, err)
+		}
+		if EqualOptional(encoded, field.last, bytes.Equal) {
+			continue
+		}
+		field.last = encoded
+		if field.notify != nil {
+			fieldNotify := field.notify
+			notify = append(notify, func() {
+				fieldNotify(encoded)
+			})
+		}
+	}
+	binding.mutex.Unlock()
+
+	for _, n := range notify {
+		n()
+	}
+
+	return nil
+}
+
+// Encodes current field value, must be called with the lock held.
+func (field *boundField) encode() (Optional[[]byte], error) {
+	value := field.binding.target.FieldByIndex(field.index).Interface()
+	encoded, err := field.codec.Encode(value)
+	if err != nil {
+		return NewUndefined[[]byte](), err
+	}
+	return NewDefined(encoded), nil
+}
+
+// Decodes value into the field, must be called with the lock held.
+func (field *boundField) decode(encoded Optional[[]byte]) bool {
+	target := field.binding.target.FieldByIndex(field.index)
+	if encoded.IsUndefined() {
+		target.SetZero()
+		field.last = encoded
+		return true
+	}
+	value, ok := field.codec.Decode(encoded.Get())
+	if !ok || !setField(target, value) {
+		return false
+	}
+	field.last = encoded
+	return true
+}
+
+func (field *boundField) changed() {
+	field.binding.mutex.Lock()
+	listener := field.binding.changeListener
+	field.binding.mutex.Unlock()
+
+	if listener != nil {
+		listener(field.name)
+	}
+}
+
+func (field *boundField) GetName() string {
+	return field.name
+}
+
+func (p *boundProvider) GetEncodedValue() (Optional[[]byte], map[string]string) {
+	p.binding.mutex.Lock()
+	defer p.binding.mutex.Unlock()
+	return p.last, p.metadata
+}
+
+func (p *boundProvider) SetEncodedValue(encoded Optional[[]byte]) {
+	if !p.rw {
+		return
+	}
+
+	p.binding.mutex.Lock()
+	ok := p.decode(encoded)
+	notify := p.notify
+	p.binding.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if notify != nil {
+		notify(encoded)
+	}
+	p.changed()
+}
+
+func (p *boundProvider) Attach(syncListener func()) {
+	p.binding.mutex.Lock()
+	defer p.binding.mutex.Unlock()
+	p.notify = func(Optional[[]byte]) {
+		syncListener()
+	}
+}
+
+func (c *boundConsumer) SetMetadata(metadata map[string]string) {
+}
+
+func (c *boundConsumer) SyncValue(encoded Optional[[]byte]) {
+	c.binding.mutex.Lock()
+	changed := !EqualOptional(encoded, c.last, bytes.Equal)
+	ok := changed && c.decode(encoded)
+	c.binding.mutex.Unlock()
+
+	if ok {
+		c.changed()
+	}
+}
+
+func (c *boundConsumer) Attach(setListener func(Optional[[]byte])) {
+	c.binding.mutex.Lock()
+	defer c.binding.mutex.Unlock()
+	c.notify = setListener
+}
@@ -0,0 +1,212 @@
+package surp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Returns group which is not connected to network, with channel of messages it sends.
+func newTestGroup() (*RegisterGroup, chan MessageAndAddr) {
+	sent := make(chan MessageAndAddr, 100)
+	group := newRegisterGroup("test", true)
+	group.unicastWriter = sent
+	return group, sent
+}
+
+func receiveMessage(t *testing.T, sent chan MessageAndAddr, typ byte, name string) *Message {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m := <-sent:
+			msg, ok := decodeMessage(m.Message[4:])
+			require.True(t, ok)
+			if msg.Type == typ && msg.Name == name {
+				return msg
+			}
+		case <-timeout:
+			require.FailNow(t, "message not sent", "%d %s", typ, name)
+		}
+	}
+}
+
+func deliver(group *RegisterGroup, msg *Message) {
+	ch := make(chan MessageAndAddr, 1)
+	msg.Group = group.name
+	encoded, _ := encodeMessage(msg, nil)
+	ch <- MessageAndAddr{Message: encoded[0], Addr: &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 1000}}
+	close(ch)
+	group.readMessages(ch)
+}
+
+func TestBind(t *testing.T) {
+
+	type device struct {
+		Setpoint float64 `surp:"setpoint,rw,unit=°C"`
+		Mode     int16   `surp:"mode"`
+		Outdoor  float64 `surp:"outdoor,consume"`
+		Ignored  string
+	}
+
+	group, sent := newTestGroup()
+
+	state := &device{Setpoint: 21}
+	binding, err := Bind(group, state)
+	require.NoError(t, err)
+
+	changes := make(chan string, 10)
+	binding.OnChange(func(name string) {
+		changes <- name
+	})
+
+	binding.Lock()
+	state.Mode = 2
+	binding.Unlock()
+	require.NoError(t, binding.Commit())
+
+	msg := receiveMessage(t, sent, MessageTypeSync, "mode")
+	require.Equal(t, EncodeInt16(2), msg.Value.Get())
+	require.Equal(t, "int16", msg.Metadata["type"])
+
+	deliver(group, &Message{Type: MessageTypeSet, Name: "setpoint", Value: NewDefined(EncodeFloat(22.5))})
+	require.Equal(t, "setpoint", <-changes)
+	msg = receiveMessage(t, sent, MessageTypeSync, "setpoint")
+	require.Equal(t, EncodeFloat(22.5), msg.Value.Get())
+	require.Equal(t, "°C", msg.Metadata["unit"])
+
+	// read-only field is not set from network
+	deliver(group, &Message{Type: MessageTypeSet, Name: "mode", Value: NewDefined(EncodeInt16(5))})
+
+	deliver(group, &Message{Type: MessageTypeSync, Name: "outdoor", Value: NewDefined(EncodeFloat(-3))})
+	require.Equal(t, "outdoor", <-changes)
+
+	binding.Lock()
+	require.Equal(t, device{Setpoint: 22.5, Mode: 2, Outdoor: -3}, *state)
+	binding.Unlock()
+}
+
+func TestRemoveRegisters(t *testing.T) {
+
+	type device struct {
+		Setpoint float64 `surp:"setpoint,rw"`
+		Outdoor  float64 `surp:"outdoor,consume"`
+	}
+
+	group, _ := newTestGroup()
+	other := &testConsumer{name: "outdoor", listener: func(Optional[[]byte]) {}}
+	require.NoError(t, group.AddConsumers(other))
+
+	_, err := Bind(group, &device{})
+	require.NoError(t, err)
+
+	// as done by Bind when adding of registers fails
+	setpoint := group.providers["setpoint"].provider
+	outdoor := group.consumers["outdoor"][1].consumer
+	group.removeProviders(setpoint)
+	group.removeConsumers(outdoor)
+
+	require.Empty(t, group.providers)
+	require.Len(t, group.consumers["outdoor"], 1)
+	require.Equal(t, other, group.consumers["outdoor"][0].consumer)
+}
+
+// Run with -race to detect removal editing consumers iterated by dispatched syncs.
+func TestRemoveConsumersWhileSyncing(t *testing.T) {
+
+	group, _ := newTestGroup()
+	defer group.dispatcher.close()
+
+	var consumers []Consumer
+	for i := 0; i < 10; i++ {
+		consumer := &testConsumer{name: "outdoor", listener: func(Optional[[]byte]) {}}
+		consumers = append(consumers, consumer)
+	}
+	require.NoError(t, group.AddConsumers(consumers...))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			deliver(group, &Message{Type: MessageTypeSync, Name: "outdoor", Value: NewDefined(EncodeInt(int64(i)))})
+		}
+	}()
+
+	for _, consumer := range consumers {
+		time.Sleep(time.Millisecond)
+		group.removeConsumers(consumer)
+	}
+	<-done
+
+	require.Empty(t, group.consumers)
+}
+
+type observedProvider struct {
+	value  Optional[[]byte]
+	synced chan Optional[[]byte]
+}
+
+func (p *observedProvider) GetName() string {
+	return "observed"
+}
+
+func (p *observedProvider) GetEncodedValue() (Optional[[]byte], map[string]string) {
+	return p.value, map[string]string{}
+}
+
+func (p *observedProvider) SetEncodedValue(Optional[[]byte]) {
+}
+
+func (p *observedProvider) Attach(func()) {
+}
+
+func (p *observedProvider) Synced(value Optional[[]byte]) {
+	p.synced <- value
+}
+
+func TestSyncObserver(t *testing.T) {
+
+	group, sent := newTestGroup()
+
+	observed := &observedProvider{value: NewDefined(EncodeInt(1)), synced: make(chan Optional[[]byte], 10)}
+	require.NoError(t, group.AddProviders(observed))
+
+	// Gets are answered by multicast sync
+	deliver(group, &Message{Type: MessageTypeGet, Name: "observed"})
+	msg := receiveMessage(t, sent, MessageTypeSync, "observed")
+
+	select {
+	case value := <-observed.synced:
+		require.Equal(t, msg.Value, value)
+	case <-time.After(time.Second):
+		require.FailNow(t, "sync not observed")
+	}
+
+	group.removeProviders(observed)
+}
+
+func TestSendError(t *testing.T) {
+
+	group, _ := newTestGroup()
+
+	errs := make(chan string, 10)
+	group.OnSendError(func(message *Message, err error) {
+		errs <- message.Name
+	})
+
+	// too long to be encoded, so it is not synced
+	observed := &observedProvider{value: NewDefined(make([]byte, MaxValueSize+1)), synced: make(chan Optional[[]byte], 10)}
+	require.NoError(t, group.AddProviders(observed))
+	deliver(group, &Message{Type: MessageTypeGet, Name: "observed"})
+
+	select {
+	case name := <-errs:
+		require.Equal(t, "observed", name)
+	case <-time.After(time.Second):
+		require.FailNow(t, "send error not reported")
+	}
+	require.Empty(t, observed.synced)
+
+	group.removeProviders(observed)
+}
@@ -0,0 +1,128 @@
+package surp
+
+import (
+	"sync"
+	"time"
+)
+
+// Longest periodic sync interval under a sync budget, so that consumers do not expire values before the next sync.
+const MaxBudgetSyncPeriod = SyncTimeout - MinSyncPeriod
+
+// Interval over which the sync rate is measured and periods are adapted.
+const budgetWindow = time.Second
+
+/*
+syncBudget limits packets sent by syncs of providers of all groups.
+
+Change-triggered syncs are sent immediately, periodic syncs share the rest of the budget
+by stretching their periods, up to MaxBudgetSyncPeriod.
+If the budget is exceeded even then, the exceeded listener is called at most once per window.
+*/
+type syncBudget struct {
+	mutex sync.Mutex
+
+	// packets per second, zero is unlimited
+	limit    float64
+	exceeded func(rate float64)
+
+	windowStart     time.Time
+	periodicPackets int
+	changePackets   int
+
+	// factor periodic sync periods are multiplied by
+	stretch float64
+}
+
+// Budget shared by all groups of the process.
+var processBudget = newSyncBudget()
+
+/*
+Limits packets sent by syncs of providers of all groups of the process to packetsPerSecond,
+zero (the default) is unlimited.
+
+Syncs triggered by value changes and Gets are sent immediately,
+periodic syncs are stretched adaptively to fit the rest of the budget, but not beyond MaxBudgetSyncPeriod.
+*/
+func SetSyncBudget(packetsPerSecond float64) {
+	processBudget.setLimit(packetsPerSecond)
+}
+
+// Sets listener called with the measured sync rate in packets per second,
+// when the budget is exceeded even with periodic syncs stretched to the maximum.
+func OnBudgetExceeded(listener func(rate float64)) {
+	processBudget.setExceededListener(listener)
+}
+
+func newSyncBudget() *syncBudget {
+	return &syncBudget{stretch: 1}
+}
+
+func (b *syncBudget) setLimit(packetsPerSecond float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.limit = packetsPerSecond
+	b.stretch = 1
+	b.windowStart = time.Time{}
+}
+
+func (b *syncBudget) setExceededListener(listener func(rate float64)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.exceeded = listener
+}
+
+// Returns the period stretched according to the budget.
+func (b *syncBudget) stretchPeriod(period time.Duration) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return min(time.Duration(float64(period)*b.stretch), MaxBudgetSyncPeriod)
+}
+
+// Records packets sent by a sync, returns the exceeded listener and measured rate if the budget was exceeded.
+func (b *syncBudget) record(packets int, periodic bool, now time.Time) (func(rate float64), float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.limit <= 0 {
+		return nil, 0
+	}
+
+	if b.windowStart.IsZero() {
+		b.windowStart = now
+	}
+
+	if periodic {
+		b.periodicPackets += packets
+	} else {
+		b.changePackets += packets
+	}
+
+	elapsed := now.Sub(b.windowStart).Seconds()
+	if elapsed < budgetWindow.Seconds() {
+		return nil, 0
+	}
+
+	periodicRate := float64(b.periodicPackets) / elapsed
+	changeRate := float64(b.changePackets) / elapsed
+	rate := periodicRate + changeRate
+
+	// change-triggered syncs take precedence, periodic syncs get what is left
+	demand := periodicRate * b.stretch
+	maxStretch := float64(MaxBudgetSyncPeriod) / float64(MinSyncPeriod)
+	stretch := maxStretch
+	if allowance := b.limit - changeRate; allowance > 0 {
+		stretch = min(max(demand/allowance, 1), maxStretch)
+	}
+	// averaged, so that periods do not oscillate with the measured rate
+	b.stretch = (b.stretch + stretch) / 2
+
+	b.windowStart = now
+	b.periodicPackets = 0
+	b.changePackets = 0
+
+	// while periods are still adapting, the rate may exceed the limit temporarily
+	if rate > b.limit && stretch == maxStretch {
+		return b.exceeded, rate
+	}
+	return nil, 0
+}
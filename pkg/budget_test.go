@@ -0,0 +1,90 @@
+package surp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncBudgetStretchesPeriods(t *testing.T) {
+
+	budget := newSyncBudget()
+	budget.setLimit(10)
+
+	var exceeded []float64
+	budget.setExceededListener(func(rate float64) {
+		exceeded = append(exceeded, rate)
+	})
+
+	// providers demand 20 periodic packets per second, twice the budget
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		packets := int(math.Round(float64(20*MinSyncPeriod) / float64(budget.stretchPeriod(MinSyncPeriod))))
+		for j := 0; j < packets; j++ {
+			now = now.Add(budgetWindow / time.Duration(packets))
+			listener, rate := budget.record(1, true, now)
+			if listener != nil {
+				listener(rate)
+			}
+		}
+	}
+
+	require.InDelta(t, 2*MinSyncPeriod, budget.stretchPeriod(MinSyncPeriod), float64(400*time.Millisecond))
+	require.Empty(t, exceeded)
+}
+
+func TestSyncBudgetPrioritizesChanges(t *testing.T) {
+
+	budget := newSyncBudget()
+	budget.setLimit(10)
+
+	var exceeded []float64
+	budget.setExceededListener(func(rate float64) {
+		exceeded = append(exceeded, rate)
+	})
+
+	// change-triggered syncs alone exceed the budget, periodic syncs are stretched to the maximum
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 20; j++ {
+			listener, rate := budget.record(1, j%2 == 0, now)
+			if listener != nil {
+				listener(rate)
+			}
+			now = now.Add(budgetWindow / 20)
+		}
+	}
+
+	require.InDelta(t, MaxBudgetSyncPeriod, budget.stretchPeriod(MaxSyncPeriod), float64(10*time.Millisecond))
+	require.NotEmpty(t, exceeded)
+}
+
+func TestSyncBudgetUnlimited(t *testing.T) {
+
+	budget := newSyncBudget()
+	listener, _ := budget.record(1000, true, time.Now())
+	require.Nil(t, listener)
+	require.Equal(t, MinSyncPeriod, budget.stretchPeriod(MinSyncPeriod))
+}
+
+func TestSyncBudgetSharedByGroups(t *testing.T) {
+
+	first, _ := newTestGroup()
+	second, _ := newTestGroup()
+	require.Same(t, processBudget, first.budget)
+	require.Same(t, first.budget, second.budget)
+
+	SetSyncBudget(10)
+	defer SetSyncBudget(0)
+
+	// packets of both groups count against the one budget
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		first.budget.record(1, true, now)
+		second.budget.record(1, true, now)
+		now = now.Add(budgetWindow / 20)
+	}
+	require.Greater(t, second.budget.stretchPeriod(MinSyncPeriod), MinSyncPeriod)
+}
@@ -0,0 +1,152 @@
+package surp
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata key under which peers advertise their protocol capabilities.
+const MetadataCapabilities = "caps"
+
+const (
+	CapabilityVersion1      = "v1"
+	CapabilityFragmentation = "frag"
+	CapabilityDeflate       = "deflate"
+)
+
+type Capabilities map[string]struct{}
+
+// Capabilities of this implementation, advertised in syncs and gets.
+var LocalCapabilities = NewCapabilities(CapabilityVersion1, CapabilityFragmentation, CapabilityDeflate)
+
+func NewCapabilities(names ...string) Capabilities {
+	caps := make(Capabilities, len(names))
+	for _, name := range names {
+		caps[name] = struct{}{}
+	}
+	return caps
+}
+
+func ParseCapabilities(s string) Capabilities {
+	caps := Capabilities{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			caps[name] = struct{}{}
+		}
+	}
+	return caps
+}
+
+func (caps Capabilities) Has(name string) bool {
+	_, ok := caps[name]
+	return ok
+}
+
+func (caps Capabilities) Intersect(other Capabilities) Capabilities {
+	result := Capabilities{}
+	for name := range caps {
+		if other.Has(name) {
+			result[name] = struct{}{}
+		}
+	}
+	return result
+}
+
+func (caps Capabilities) String() string {
+	names := make([]string, 0, len(caps))
+	for name := range caps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+/*
+Capabilities of remote peers, learned from their syncs and gets.
+Peers are identified by the source address of their unicast socket, messages from self are ignored.
+
+A peer which never advertised anything is known to be legacy and it is never forgotten.
+Other peers silent for longer than expiry are forgotten, so that a peer which left does not limit the group.
+
+Multicast messages use extensions only if enabled, since legacy pure consumers may never be heard.
+*/
+type peerTable struct {
+	peers     map[string]peer
+	expiry    time.Duration
+	self      *net.UDPAddr
+	multicast bool
+	mutex     sync.Mutex
+}
+
+type peer struct {
+	caps Capabilities
+	seen time.Time
+}
+
+func newPeerTable() *peerTable {
+	return &peerTable{
+		peers:  make(map[string]peer),
+		expiry: SyncTimeout,
+	}
+}
+
+func (table *peerTable) update(addr *net.UDPAddr, metadata map[string]string) {
+	caps := ParseCapabilities(metadata[MetadataCapabilities])
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	// own multicasts are looped back
+	if table.self != nil && addr.IP.Equal(table.self.IP) && addr.Port == table.self.Port {
+		return
+	}
+
+	table.peers[addr.String()] = peer{caps: caps, seen: time.Now()}
+}
+
+func (table *peerTable) setSelf(addr *net.UDPAddr) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.self = addr
+}
+
+func (table *peerTable) setMulticast(enabled bool) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.multicast = enabled
+}
+
+// Returns features which may be used toward the given address.
+// For multicast addresses, only features enabled for multicast and supported by all known peers are returned.
+func (table *peerTable) features(addr *net.UDPAddr) Capabilities {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	for key, p := range table.peers {
+		if len(p.caps) > 0 && time.Since(p.seen) > table.expiry {
+			delete(table.peers, key)
+		}
+	}
+
+	if !addr.IP.IsMulticast() {
+		p, ok := table.peers[addr.String()]
+		if !ok {
+			return Capabilities{}
+		}
+		return LocalCapabilities.Intersect(p.caps)
+	}
+
+	if !table.multicast || len(table.peers) == 0 {
+		return Capabilities{}
+	}
+
+	result := LocalCapabilities
+	for _, p := range table.peers {
+		result = result.Intersect(p.caps)
+	}
+	return result
+}
@@ -0,0 +1,437 @@
+package surp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+CBOR Encoding (Binary):
+
+	Values of "cbor" type are self-describing, encoded as CBOR data items (RFC 8949).
+	Maps are encoded with keys in deterministic order (bytewise order of encoded keys),
+	integers in the shortest form and floats as float64 (float32 for float32 values).
+
+Encoded Go values are nil, bool, integers, floats, string, []byte, slices, arrays,
+maps and structs (as maps keyed by field names or their json tags).
+
+Decoded values are nil, bool, int64 (uint64 if greater than MaxInt64), float64, string, []byte,
+[]any and map[string]any; non-string map keys are converted to strings, tags are ignored.
+*/
+
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborTag      = 6
+	cborSimple   = 7
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+
+	// nesting limit, so that malicious values can not exhaust stack
+	cborMaxDepth = 64
+)
+
+func EncodeCBOR(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCBOR(&buf, reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DecodeCBOR(b []byte) (any, bool) {
+	v, err := readCBOR(&b, 0)
+	if err != nil || len(b) > 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func writeCBOR(buf *bytes.Buffer, rv reflect.Value, depth int) error {
+
+	if depth > cborMaxDepth {
+		return errors.New("value is nested too deep to be encoded as cbor")
+	}
+
+	if !rv.IsValid() {
+		buf.WriteByte(0xf6)
+		return nil
+	}
+
+	if n, ok := rv.Interface().(json.Number); ok {
+		return writeCBORNumber(buf, n)
+	}
+
+	switch rv.Kind() {
+
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		return writeCBOR(buf, rv.Elem(), depth)
+
+	case reflect.Bool:
+		if rv.Bool() {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i >= 0 {
+			writeCBORHead(buf, cborUnsigned, uint64(i))
+		} else {
+			writeCBORHead(buf, cborNegative, uint64(-1-i))
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeCBORHead(buf, cborUnsigned, rv.Uint())
+
+	case reflect.Float32:
+		buf.WriteByte(0xfa)
+		buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(rv.Float()))))
+
+	case reflect.Float64:
+		buf.WriteByte(0xfb)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(rv.Float())))
+
+	case reflect.String:
+		writeCBORHead(buf, cborText, uint64(rv.Len()))
+		buf.WriteString(rv.String())
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			writeCBORHead(buf, cborBytes, uint64(rv.Len()))
+			for i := 0; i < rv.Len(); i++ {
+				buf.WriteByte(byte(rv.Index(i).Uint()))
+			}
+			return nil
+		}
+		writeCBORHead(buf, cborArray, uint64(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			if err := writeCBOR(buf, rv.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if rv.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		entries := make([][2][]byte, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			var k, v bytes.Buffer
+			if err := writeCBOR(&k, iter.Key(), depth+1); err != nil {
+				return err
+			}
+			if err := writeCBOR(&v, iter.Value(), depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, [2][]byte{k.Bytes(), v.Bytes()})
+		}
+		writeCBOREntries(buf, entries)
+
+	case reflect.Struct:
+		t := rv.Type()
+		entries := make([][2][]byte, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			var k, v bytes.Buffer
+			writeCBORHead(&k, cborText, uint64(len(name)))
+			k.WriteString(name)
+			if err := writeCBOR(&v, rv.Field(i), depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, [2][]byte{k.Bytes(), v.Bytes()})
+		}
+		writeCBOREntries(buf, entries)
+
+	default:
+		return fmt.Errorf("value of type %s can not be encoded as cbor", rv.Type())
+	}
+
+	return nil
+}
+
+func writeCBOREntries(buf *bytes.Buffer, entries [][2][]byte) {
+	slices.SortFunc(entries, func(a, b [2][]byte) int {
+		return bytes.Compare(a[0], b[0])
+	})
+	writeCBORHead(buf, cborMap, uint64(len(entries)))
+	for _, entry := range entries {
+		buf.Write(entry[0])
+		buf.Write(entry[1])
+	}
+}
+
+// Writes number parsed from JSON as integer if possible, float otherwise.
+func writeCBORNumber(buf *bytes.Buffer, n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		return writeCBOR(buf, reflect.ValueOf(i), 0)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	return writeCBOR(buf, reflect.ValueOf(f), 0)
+}
+
+var errCBOR = errors.New("invalid cbor value")
+
+// Reads head of data item, returns major type, additional info and argument.
+func readCBORHead(remaining *[]byte) (byte, byte, uint64, error) {
+	b := *remaining
+	if len(b) == 0 {
+		return 0, 0, 0, errCBOR
+	}
+
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < size {
+			return 0, 0, 0, errCBOR
+		}
+		for _, c := range b[:size] {
+			arg = arg<<8 | uint64(c)
+		}
+		b = b[size:]
+	case info == cborIndefinite && major >= cborBytes && major != cborTag:
+	default:
+		return 0, 0, 0, errCBOR
+	}
+
+	*remaining = b
+	return major, info, arg, nil
+}
+
+func readCBOR(remaining *[]byte, depth int) (any, error) {
+
+	if depth > cborMaxDepth {
+		return nil, errCBOR
+	}
+
+	major, info, arg, err := readCBORHead(remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+
+	case cborBytes, cborText:
+		var data []byte
+		if info == cborIndefinite {
+			// concatenation of definite length chunks of the same major type
+			data = []byte{}
+			for !readCBORBreak(remaining) {
+				chunkMajor, chunkInfo, n, err := readCBORHead(remaining)
+				if err != nil || chunkMajor != major || chunkInfo == cborIndefinite || n > uint64(len(*remaining)) {
+					return nil, errCBOR
+				}
+				data = append(data, (*remaining)[:n]...)
+				*remaining = (*remaining)[n:]
+			}
+		} else {
+			if arg > uint64(len(*remaining)) {
+				return nil, errCBOR
+			}
+			data = bytes.Clone((*remaining)[:arg])
+			*remaining = (*remaining)[arg:]
+		}
+		if major == cborText {
+			if !utf8.Valid(data) {
+				return nil, errCBOR
+			}
+			return string(data), nil
+		}
+		return data, nil
+
+	case cborArray:
+		// each item takes at least one byte, so larger counts are invalid
+		if info != cborIndefinite && arg > uint64(len(*remaining)) {
+			return nil, errCBOR
+		}
+		result := []any{}
+		for i := uint64(0); info == cborIndefinite || i < arg; i++ {
+			if info == cborIndefinite && readCBORBreak(remaining) {
+				break
+			}
+			item, err := readCBOR(remaining, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+		}
+		return result, nil
+
+	case cborMap:
+		if info != cborIndefinite && arg > uint64(len(*remaining))/2 {
+			return nil, errCBOR
+		}
+		result := map[string]any{}
+		for i := uint64(0); info == cborIndefinite || i < arg; i++ {
+			if info == cborIndefinite && readCBORBreak(remaining) {
+				break
+			}
+			key, err := readCBOR(remaining, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value, err := readCBOR(remaining, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := key.(string)
+			if !ok {
+				s = formatCBORKey(key)
+			}
+			result[s] = value
+		}
+		return result, nil
+
+	case cborTag:
+		return readCBOR(remaining, depth+1)
+
+	case cborSimple:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			return float16ToFloat64(uint16(arg)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case 27:
+			return math.Float64frombits(arg), nil
+		}
+	}
+
+	return nil, errCBOR
+}
+
+func readCBORBreak(remaining *[]byte) bool {
+	if len(*remaining) > 0 && (*remaining)[0] == cborBreak {
+		*remaining = (*remaining)[1:]
+		return true
+	}
+	return false
+}
+
+func formatCBORKey(key any) string {
+	b, err := json.Marshal(key)
+	if err != nil {
+		return formatAny(key)
+	}
+	return string(b)
+}
+
+func float16ToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func init() {
+	RegisterCodec("cbor", EncodeCBOR, DecodeCBOR, func(s string) (any, error) {
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		var v any
+		if err := decoder.Decode(&v); err != nil {
+			return nil, err
+		}
+		if decoder.More() {
+			return nil, errors.New("cbor value must be a single JSON value")
+		}
+		return v, nil
+	}, func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return formatAny(v)
+		}
+		return string(b)
+	})
+}
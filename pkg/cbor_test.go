@@ -0,0 +1,116 @@
+package surp
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Examples from RFC 8949, Appendix A.
+func TestCBORVectors(t *testing.T) {
+
+	vectors := []struct {
+		value   any
+		encoded string
+	}{
+		{int64(0), "00"},
+		{int64(23), "17"},
+		{int64(24), "1818"},
+		{int64(1000), "1903e8"},
+		{int64(1000000000000), "1b000000e8d4a51000"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{int64(-1), "20"},
+		{int64(-1000), "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{-4.1, "fbc010666666666666"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{"", "60"},
+		{"IETF", "6449455446"},
+		{"ü", "62c3bc"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]any{}, "80"},
+		{[]any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}, "8301820203820405"},
+		{map[string]any{}, "a0"},
+		{map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}, "a26161016162820203"},
+	}
+
+	for _, v := range vectors {
+		encoded, err := EncodeCBOR(v.value)
+		require.NoError(t, err)
+		require.Equal(t, v.encoded, hex.EncodeToString(encoded), v.value)
+
+		decoded, ok := DecodeCBOR(encoded)
+		require.True(t, ok, v.encoded)
+		require.Equal(t, v.value, decoded, v.encoded)
+	}
+
+	decodeOnly := []struct {
+		encoded string
+		value   any
+	}{
+		{"f93c00", 1.0},
+		{"f97bff", 65504.0},
+		{"f90001", 5.960464477539063e-8},
+		{"f9fc00", math.Inf(-1)},
+		{"fa47c35000", 100000.0},
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"bf61610161629f0203ffff", map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"a201020304", map[string]any{"1": int64(2), "3": int64(4)}},
+	}
+
+	for _, v := range decodeOnly {
+		b, _ := hex.DecodeString(v.encoded)
+		decoded, ok := DecodeCBOR(b)
+		require.True(t, ok, v.encoded)
+		require.Equal(t, v.value, decoded, v.encoded)
+	}
+
+	for _, invalid := range []string{"", "18", "1c", "62c3", "63ffffff", "9bffffffffffffffff", "a1", "ff", "5f01ff", "3bffffffffffffffff", "0000"} {
+		b, _ := hex.DecodeString(invalid)
+		_, ok := DecodeCBOR(b)
+		require.False(t, ok, invalid)
+	}
+}
+
+func TestCBORCodec(t *testing.T) {
+
+	type reading struct {
+		Sensor string    `json:"sensor"`
+		Values []float64 `json:"values"`
+		Raw    []byte
+		Debug  string `json:"-"`
+	}
+
+	encoded, err := EncodeGeneric(reading{Sensor: "t1", Values: []float64{1.5}, Raw: []byte{1}}, "cbor")
+	require.NoError(t, err)
+
+	decoded, ok := DecodeGeneric(encoded, "cbor")
+	require.True(t, ok)
+	require.Equal(t, map[string]any{"sensor": "t1", "values": []any{1.5}, "Raw": []byte{1}}, decoded)
+	require.Equal(t, `{"Raw":"AQ==","sensor":"t1","values":[1.5]}`, FormatGeneric(decoded, "cbor"))
+
+	parsed, err := ParseGeneric(`{"n":[1,2.5,{"x":null}],"s":"a"}`, "cbor")
+	require.NoError(t, err)
+	encoded, err = EncodeGeneric(parsed, "cbor")
+	require.NoError(t, err)
+	decoded, ok = DecodeGeneric(encoded, "cbor")
+	require.True(t, ok)
+	require.Equal(t, map[string]any{"n": []any{int64(1), 2.5, map[string]any{"x": nil}}, "s": "a"}, decoded)
+
+	nested := []any{}
+	for i := 0; i < 100; i++ {
+		nested = []any{nested}
+	}
+	_, err = EncodeCBOR(nested)
+	require.Error(t, err)
+
+	_, err = EncodeCBOR(make(chan int))
+	require.Error(t, err)
+}
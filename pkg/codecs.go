@@ -0,0 +1,389 @@
+package surp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codec converts register values of a particular type between Go, wire and text representations.
+// Values are passed as any, typed by the canonical Go type of the codec (e.g. int64 for "int").
+type Codec struct {
+	Encode func(any) ([]byte, error)
+	Decode func([]byte) (any, bool)
+	Parse  func(string) (any, error)
+	Format func(any) string
+}
+
+var (
+	codecs         = map[string]*Codec{}
+	codecFactories = map[string]func(map[string]string) (*Codec, error){}
+	codecsMutex    sync.RWMutex
+)
+
+// Registers codec for the given type name, as advertised in "type" metadata key.
+// Registering the same type name again replaces the previous codec.
+func RegisterCodec(typeName string, encoder func(any) ([]byte, error), decoder func([]byte) (any, bool), parser func(string) (any, error), formatter func(any) string) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	codecs[typeName] = &Codec{
+		Encode: encoder,
+		Decode: decoder,
+		Parse:  parser,
+		Format: formatter,
+	}
+}
+
+func GetCodec(typeName string) (*Codec, bool) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	codec, ok := codecs[typeName]
+	return codec, ok
+}
+
+// Registers factory creating codecs of the given type name from register metadata,
+// for types whose encoding is described by other metadata keys (e.g. struct schema).
+func RegisterCodecFactory(typeName string, factory func(metadata map[string]string) (*Codec, error)) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	codecFactories[typeName] = factory
+}
+
+// Returns codec for the register described by the given metadata.
+func ResolveCodec(metadata map[string]string) (*Codec, error) {
+	typ := metadata["type"]
+
+	codecsMutex.RLock()
+	factory, ok := codecFactories[typ]
+	codecsMutex.RUnlock()
+
+	if ok {
+		return factory(metadata)
+	}
+
+	// integer types may carry fixed-point engineering values
+	if scalableTypes[typ] {
+		scale, offset, scaled, err := ParseScale(metadata)
+		if err != nil {
+			return nil, err
+		}
+		if scaled {
+			return scaledCodec(typ, scale, offset)
+		}
+	}
+
+	codec, ok := GetCodec(typ)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %s", typ)
+	}
+	return codec, nil
+}
+
+func EncodeGeneric(v any, typ string) ([]byte, error) {
+	codec, ok := GetCodec(typ)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %s", typ)
+	}
+	return codec.Encode(v)
+}
+
+func DecodeGeneric(b []byte, typ string) (any, bool) {
+	codec, ok := GetCodec(typ)
+	if !ok {
+		return nil, false
+	}
+	return codec.Decode(b)
+}
+
+func ParseGeneric(s string, typ string) (any, error) {
+	codec, ok := GetCodec(typ)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %s", typ)
+	}
+	return codec.Parse(s)
+}
+
+func FormatGeneric(v any, typ string) string {
+	codec, ok := GetCodec(typ)
+	if !ok {
+		return fmt.Sprintf("%v", v)
+	}
+	return codec.Format(v)
+}
+
+func typeError(v any, typ string) error {
+	return fmt.Errorf("value %v of type %T can not be encoded as %s", v, v, typ)
+}
+
+// Returns SURP type name for values of the given Go type.
+func typeNameOf(t reflect.Type) (string, bool) {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return "time", true
+	case reflect.TypeFor[time.Duration]():
+		return "duration", true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string", true
+	case reflect.Bool:
+		return "bool", true
+	case reflect.Int, reflect.Int64:
+		return "int", true
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32:
+		return t.Kind().String(), true
+	case reflect.Uint:
+		return "uint64", true
+	case reflect.Float64:
+		return "float", true
+	case reflect.Slice, reflect.Array:
+		elem, ok := typeNameOf(t.Elem())
+		if !ok || strings.HasSuffix(elem, ArrayTypeSuffix) {
+			return "", false
+		}
+		return elem + ArrayTypeSuffix, true
+	}
+	return "", false
+}
+
+// Converts any Go integer to int64.
+func toInt64(v any) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(u), true
+	}
+	return 0, false
+}
+
+// Converts any non-negative Go integer to uint64.
+func toUint64(v any) (uint64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), true
+	}
+	i, ok := toInt64(v)
+	if !ok || i < 0 {
+		return 0, false
+	}
+	return uint64(i), true
+}
+
+// Converts any Go integer or float to float64.
+func toFloat64(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	i, ok := toInt64(v)
+	return float64(i), ok
+}
+
+func formatAny(v any) string {
+	return fmt.Sprintf("%v", v)
+}
+
+func registerSignedCodec[T int8 | int16 | int32](typ string, bits int, encoder Encoder[T], decoder Decoder[T]) {
+	RegisterCodec(typ, func(v any) ([]byte, error) {
+		i, ok := toInt64(v)
+		if !ok {
+			return nil, typeError(v, typ)
+		}
+		if i < -1<<(bits-1) || i > 1<<(bits-1)-1 {
+			return nil, fmt.Errorf("value %d out of range of %s", i, typ)
+		}
+		return encoder(T(i)), nil
+	}, func(b []byte) (any, bool) {
+		return decoder(b)
+	}, func(s string) (any, error) {
+		i, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		return T(i), nil
+	}, formatAny)
+}
+
+func registerUnsignedCodec[T uint8 | uint16 | uint32 | uint64](typ string, bits int, encoder Encoder[T], decoder Decoder[T]) {
+	RegisterCodec(typ, func(v any) ([]byte, error) {
+		u, ok := toUint64(v)
+		if !ok {
+			if _, isInt := toInt64(v); isInt {
+				return nil, fmt.Errorf("value %v out of range of %s", v, typ)
+			}
+			return nil, typeError(v, typ)
+		}
+		if bits < 64 && u > 1<<bits-1 {
+			return nil, fmt.Errorf("value %d out of range of %s", u, typ)
+		}
+		return encoder(T(u)), nil
+	}, func(b []byte) (any, bool) {
+		return decoder(b)
+	}, func(s string) (any, error) {
+		u, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		return T(u), nil
+	}, formatAny)
+}
+
+func init() {
+
+	RegisterCodec("string", func(v any) ([]byte, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError(v, "string")
+		}
+		return EncodeString(s), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeString(b)
+	}, func(s string) (any, error) {
+		return s, nil
+	}, formatAny)
+
+	RegisterCodec("int", func(v any) ([]byte, error) {
+		i, ok := toInt64(v)
+		if !ok {
+			return nil, typeError(v, "int")
+		}
+		return EncodeInt(i), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeInt(b)
+	}, func(s string) (any, error) {
+		return strconv.ParseInt(s, 10, 64)
+	}, formatAny)
+
+	RegisterCodec("bool", func(v any) ([]byte, error) {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, typeError(v, "bool")
+		}
+		return EncodeBool(b), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeBool(b)
+	}, func(s string) (any, error) {
+		return strconv.ParseBool(s)
+	}, formatAny)
+
+	RegisterCodec("float", func(v any) ([]byte, error) {
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, typeError(v, "float")
+		}
+		return EncodeFloat(f), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeFloat(b)
+	}, func(s string) (any, error) {
+		return strconv.ParseFloat(s, 64)
+	}, formatAny)
+
+	registerSignedCodec("int8", 8, EncodeInt8, DecodeInt8)
+	registerSignedCodec("int16", 16, EncodeInt16, DecodeInt16)
+	registerSignedCodec("int32", 32, EncodeInt32, DecodeInt32)
+
+	registerUnsignedCodec("uint8", 8, EncodeUint8, DecodeUint8)
+	registerUnsignedCodec("uint16", 16, EncodeUint16, DecodeUint16)
+	registerUnsignedCodec("uint32", 32, EncodeUint32, DecodeUint32)
+	registerUnsignedCodec("uint64", 64, EncodeUint64, DecodeUint64)
+
+	RegisterCodec("float32", func(v any) ([]byte, error) {
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, typeError(v, "float32")
+		}
+		if math.Abs(f) > math.MaxFloat32 && !math.IsInf(f, 0) {
+			return nil, fmt.Errorf("value %g out of range of float32", f)
+		}
+		return EncodeFloat32(float32(f)), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeFloat32(b)
+	}, func(s string) (any, error) {
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, err
+		}
+		return float32(f), nil
+	}, formatAny)
+
+	RegisterCodec("bytes", func(v any) ([]byte, error) {
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, typeError(v, "bytes")
+		}
+		return EncodeBytes(b), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeBytes(b)
+	}, func(s string) (any, error) {
+		return hex.DecodeString(s)
+	}, func(v any) string {
+		b, ok := v.([]byte)
+		if !ok {
+			return formatAny(v)
+		}
+		return hex.EncodeToString(b)
+	})
+
+	RegisterCodec("time", func(v any) ([]byte, error) {
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, typeError(v, "time")
+		}
+		return EncodeTime(t)
+	}, func(b []byte) (any, bool) {
+		return DecodeTime(b)
+	}, func(s string) (any, error) {
+		return time.Parse(time.RFC3339Nano, s)
+	}, func(v any) string {
+		t, ok := v.(time.Time)
+		if !ok {
+			return formatAny(v)
+		}
+		return t.Format(time.RFC3339Nano)
+	})
+
+	RegisterCodec("duration", func(v any) ([]byte, error) {
+		d, ok := v.(time.Duration)
+		if !ok {
+			return nil, typeError(v, "duration")
+		}
+		return EncodeDuration(d), nil
+	}, func(b []byte) (any, bool) {
+		return DecodeDuration(b)
+	}, func(s string) (any, error) {
+		return time.ParseDuration(s)
+	}, formatAny)
+
+	RegisterCodec("json", func(v any) ([]byte, error) {
+		return EncodeJSON(v)
+	}, func(b []byte) (any, bool) {
+		return DecodeJSON[any](b)
+	}, func(s string) (any, error) {
+		var v any
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	}, func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return formatAny(v)
+		}
+		return string(b)
+	})
+}
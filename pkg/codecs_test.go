@@ -0,0 +1,394 @@
+package surp
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinCodecs(t *testing.T) {
+
+	encoded, err := EncodeGeneric(42, "int")
+	require.NoError(t, err)
+	require.Equal(t, EncodeInt(42), encoded)
+
+	decoded, ok := DecodeGeneric(encoded, "int")
+	require.True(t, ok)
+	require.Equal(t, int64(42), decoded)
+
+	_, err = EncodeGeneric("42", "int")
+	require.Error(t, err)
+
+	_, err = EncodeGeneric(1, "unknown")
+	require.Error(t, err)
+
+	parsed, err := ParseGeneric("2.5", "float")
+	require.NoError(t, err)
+	require.Equal(t, 2.5, parsed)
+	require.Equal(t, "2.5", FormatGeneric(parsed, "float"))
+}
+
+func TestRegisterCodec(t *testing.T) {
+
+	RegisterCodec("upper", func(v any) ([]byte, error) {
+		return []byte(strings.ToUpper(v.(string))), nil
+	}, func(b []byte) (any, bool) {
+		return string(b), true
+	}, func(s string) (any, error) {
+		return s, nil
+	}, func(v any) string {
+		return "'" + v.(string) + "'"
+	})
+
+	encoded, err := EncodeGeneric("abc", "upper")
+	require.NoError(t, err)
+	require.Equal(t, []byte("ABC"), encoded)
+	require.Equal(t, "'ABC'", FormatGeneric("ABC", "upper"))
+}
+
+func TestSizedCodecs(t *testing.T) {
+
+	encoded, err := EncodeGeneric(-2, "int16")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xFF, 0xFE}, encoded)
+
+	decoded, ok := DecodeGeneric(encoded, "int16")
+	require.True(t, ok)
+	require.Equal(t, int16(-2), decoded)
+
+	_, err = EncodeGeneric(128, "int8")
+	require.Error(t, err)
+
+	_, err = EncodeGeneric(-1, "uint32")
+	require.Error(t, err)
+
+	_, err = EncodeGeneric(256, "uint8")
+	require.Error(t, err)
+
+	encoded, err = EncodeGeneric(uint64(1<<63), "uint64")
+	require.NoError(t, err)
+	decoded, ok = DecodeGeneric(encoded, "uint64")
+	require.True(t, ok)
+	require.Equal(t, uint64(1<<63), decoded)
+
+	parsed, err := ParseGeneric("1.5", "float32")
+	require.NoError(t, err)
+	require.Equal(t, float32(1.5), parsed)
+
+	_, err = EncodeGeneric(1e39, "float32")
+	require.Error(t, err)
+
+	_, err = ParseGeneric("70000", "uint16")
+	require.Error(t, err)
+}
+
+func TestJSONCodec(t *testing.T) {
+
+	parsed, err := ParseGeneric(`{"b":[1,2],"a":"x"}`, "json")
+	require.NoError(t, err)
+
+	encoded, err := EncodeGeneric(parsed, "json")
+	require.NoError(t, err)
+	require.Equal(t, `{"a":"x","b":[1,2]}`, string(encoded))
+
+	decoded, ok := DecodeGeneric(encoded, "json")
+	require.True(t, ok)
+	require.Equal(t, parsed, decoded)
+
+	_, err = ParseGeneric(`{"a":`, "json")
+	require.Error(t, err)
+
+	type point struct {
+		X, Y int
+	}
+	equal := EqualEncoded(EncodeJSON[point])
+	require.True(t, equal(point{1, 2}, point{1, 2}))
+	require.False(t, equal(point{1, 2}, point{2, 1}))
+}
+
+func TestBytesCodec(t *testing.T) {
+
+	parsed, err := ParseGeneric("00ff10", "bytes")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0xff, 0x10}, parsed)
+
+	encoded, err := EncodeGeneric(parsed, "bytes")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0xff, 0x10}, encoded)
+
+	decoded, ok := DecodeGeneric([]byte{}, "bytes")
+	require.True(t, ok)
+	require.Equal(t, []byte{}, decoded)
+
+	require.Equal(t, "00ff10", FormatGeneric(parsed, "bytes"))
+
+	_, err = ParseGeneric("0xff", "bytes")
+	require.Error(t, err)
+
+	_, err = EncodeGeneric("abc", "bytes")
+	require.Error(t, err)
+}
+
+func TestTimeCodecs(t *testing.T) {
+
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+
+	encoded, err := EncodeGeneric(ts, "time")
+	require.NoError(t, err)
+	require.Equal(t, EncodeInt(ts.UnixNano()), encoded)
+
+	decoded, ok := DecodeGeneric(encoded, "time")
+	require.True(t, ok)
+	require.True(t, ts.Equal(decoded.(time.Time)))
+
+	parsed, err := ParseGeneric("2024-03-01T13:30:00.0000005+01:00", "time")
+	require.NoError(t, err)
+	require.True(t, ts.Equal(parsed.(time.Time)))
+	require.Equal(t, "2024-03-01T12:30:00.0000005Z", FormatGeneric(ts, "time"))
+
+	// Unix nanoseconds do not cover the zero time and distant years
+	_, err = EncodeGeneric(time.Time{}, "time")
+	require.Error(t, err)
+	_, err = EncodeTime(time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+	_, err = EncodeTime(MaxTime)
+	require.NoError(t, err)
+
+	parsed, err = ParseGeneric("1m30s", "duration")
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Second, parsed)
+	require.Equal(t, "1m30s", FormatGeneric(parsed, "duration"))
+
+	encoded, err = EncodeGeneric(parsed, "duration")
+	require.NoError(t, err)
+	require.Equal(t, EncodeInt(int64(90*time.Second)), encoded)
+
+	_, err = EncodeGeneric(int64(5), "duration")
+	require.Error(t, err)
+
+	durations := []time.Duration{time.Second, 1500 * time.Millisecond}
+	formatted := FormatGeneric(durations, "duration[]")
+	require.Equal(t, `["1s","1.5s"]`, formatted)
+	parsed, err = ParseGeneric(formatted, "duration[]")
+	require.NoError(t, err)
+	require.Equal(t, durations, parsed)
+
+	codec, err := ResolveCodec(map[string]string{"type": "struct", MetadataSchema: "interval:duration,count:int"})
+	require.NoError(t, err)
+	value, err := codec.Parse(`{"interval":"2s","count":3}`)
+	require.NoError(t, err)
+	require.Equal(t, `{"count":3,"interval":"2s"}`, codec.Format(value))
+
+	typ, ok := typeNameOf(reflect.TypeFor[[]time.Time]())
+	require.True(t, ok)
+	require.Equal(t, "time[]", typ)
+}
+
+func TestEnumCodec(t *testing.T) {
+
+	codec, err := ResolveCodec(map[string]string{"type": "enum", MetadataEnum: "off,auto,manual"})
+	require.NoError(t, err)
+
+	parsed, err := codec.Parse("auto")
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode(parsed)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, encoded)
+
+	decoded, ok := codec.Decode([]byte{2})
+	require.True(t, ok)
+	require.Equal(t, "manual", decoded)
+
+	_, ok = codec.Decode([]byte{3})
+	require.False(t, ok)
+
+	_, err = codec.Parse("on")
+	require.ErrorContains(t, err, "off, auto, manual")
+
+	// fewer than MaxEnumSymbols, but too long for metadata value
+	tooLong := make([]string, 50)
+	for i := range tooLong {
+		tooLong[i] = "symbol" + strconv.Itoa(i)
+	}
+
+	for _, symbols := range []string{"", "a,,b", "a,b,a", strings.Join(tooLong, ",")} {
+		_, err = ResolveCodec(map[string]string{"type": "enum", MetadataEnum: symbols})
+		require.Error(t, err, symbols)
+	}
+
+	require.NoError(t, ValidateEnumSymbols([]string{"off", "auto"}))
+	require.Error(t, ValidateEnumSymbols([]string{"a,b", "c"}))
+}
+
+func TestScaledCodec(t *testing.T) {
+
+	codec, err := ResolveCodec(map[string]string{"type": "int16", MetadataScale: "0.1"})
+	require.NoError(t, err)
+
+	parsed, err := codec.Parse("21.55")
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode(parsed)
+	require.NoError(t, err)
+	require.Equal(t, EncodeInt16(216), encoded)
+
+	encoded, err = codec.Encode(-21.55)
+	require.NoError(t, err)
+	require.Equal(t, EncodeInt16(-216), encoded)
+
+	decoded, ok := codec.Decode(EncodeInt16(215))
+	require.True(t, ok)
+	require.InDelta(t, 21.5, decoded, 1e-9)
+
+	_, err = codec.Encode(3276.8)
+	require.ErrorContains(t, err, "out of range")
+
+	codec, err = ResolveCodec(map[string]string{"type": "uint8", MetadataScale: "0.5", MetadataOffset: "-40"})
+	require.NoError(t, err)
+
+	encoded, err = codec.Encode(-40)
+	require.NoError(t, err)
+	require.Equal(t, EncodeUint8(0), encoded)
+
+	decoded, ok = codec.Decode(EncodeUint8(255))
+	require.True(t, ok)
+	require.Equal(t, 87.5, decoded)
+
+	_, err = codec.Encode(-40.5)
+	require.Error(t, err)
+
+	_, err = ResolveCodec(map[string]string{"type": "int16", MetadataScale: "0"})
+	require.Error(t, err)
+
+	// scale of non-integer types is informative only
+	codec, err = ResolveCodec(map[string]string{"type": "float", MetadataScale: "0.1"})
+	require.NoError(t, err)
+	encoded, err = codec.Encode(1.5)
+	require.NoError(t, err)
+	require.Equal(t, EncodeFloat(1.5), encoded)
+}
+
+func TestArrayCodecs(t *testing.T) {
+
+	encoded, err := EncodeArray([]int16{1, -1}, "int16")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 0xFF, 0xFF}, encoded)
+
+	decoded, ok := DecodeArray[int16](encoded, "int16")
+	require.True(t, ok)
+	require.Equal(t, []int16{1, -1}, decoded)
+
+	_, ok = DecodeArray[int16](encoded[:3], "int16")
+	require.False(t, ok)
+
+	encoded, err = EncodeGeneric([]any{"a", "", "bc"}, "string[]")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 'a', 0, 2, 'b', 'c'}, encoded)
+
+	strs, ok := DecodeArray[string](encoded, "string")
+	require.True(t, ok)
+	require.Equal(t, []string{"a", "", "bc"}, strs)
+
+	_, err = EncodeGeneric([]int{1, 300}, "uint8[]")
+	require.Error(t, err)
+
+	parsed, err := ParseGeneric(`[1, 2.5]`, "float[]")
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 2.5}, parsed)
+	require.Equal(t, `[1,2.5]`, FormatGeneric(parsed, "float[]"))
+
+	parsed, err = ParseGeneric(`[255, 0]`, "uint8[]")
+	require.NoError(t, err)
+	require.Equal(t, `[255,0]`, FormatGeneric(parsed, "uint8[]"))
+
+	empty, ok := DecodeGeneric(nil, "bool[]")
+	require.True(t, ok)
+	require.Equal(t, []bool{}, empty)
+
+	// element codec replaced by one of other Go type
+	boolCodec, _ := GetCodec("bool")
+	defer RegisterCodec("bool", boolCodec.Encode, boolCodec.Decode, boolCodec.Parse, boolCodec.Format)
+	RegisterCodec("bool", boolCodec.Encode, func(b []byte) (any, bool) {
+		return "yes", true
+	}, func(s string) (any, error) {
+		return "yes", nil
+	}, boolCodec.Format)
+
+	_, ok = DecodeGeneric([]byte{1}, "bool[]")
+	require.False(t, ok)
+	_, err = ParseGeneric(`[true]`, "bool[]")
+	require.Error(t, err)
+}
+
+func TestDefaultEqual(t *testing.T) {
+
+	intEqual := DefaultEqual(func(v int64) ([]byte, error) {
+		panic("comparable values must not be encoded")
+	})
+	require.True(t, intEqual(1, 1))
+	require.False(t, intEqual(1, 2))
+
+	anyEqual := DefaultEqual(func(v any) ([]byte, error) {
+		return EncodeGeneric(v, "json")
+	})
+	require.True(t, anyEqual(map[string]any{"a": 1.0}, map[string]any{"a": 1.0}))
+	require.False(t, anyEqual([]any{1.0}, []any{2.0}))
+}
+
+func TestStructCodec(t *testing.T) {
+
+	type climate struct {
+		Temp     float64 `surp:"temp,type=int16,scale=0.1"`
+		Humidity uint8   `surp:"humidity"`
+		Label    string
+		Probes   []int
+		internal int
+		Debug    string `surp:"-"`
+	}
+
+	schema, err := SchemaOf(reflect.TypeFor[climate]())
+	require.NoError(t, err)
+	require.Equal(t, "temp:int16*0.1,humidity:uint8,Label:string,Probes:int[]", schema.String())
+
+	value := climate{Temp: 21.5, Humidity: 40, Label: "north", Probes: []int{1, 2}, Debug: "x"}
+
+	encoded, err := EncodeStruct(value)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 215, 40}, encoded[:3])
+
+	decoded, ok := DecodeStruct[climate](encoded)
+	require.True(t, ok)
+	require.Equal(t, climate{Temp: 21.5, Humidity: 40, Label: "north", Probes: []int{1, 2}}, decoded)
+
+	codec, err := ResolveCodec(map[string]string{"type": "struct", MetadataSchema: schema.String()})
+	require.NoError(t, err)
+
+	fields, ok := codec.Decode(encoded)
+	require.True(t, ok)
+	require.Equal(t, map[string]any{"temp": 21.5, "humidity": uint8(40), "Label": "north", "Probes": []int64{1, 2}}, fields)
+
+	parsed, err := codec.Parse(`{"temp": 20, "humidity": 50, "Label": "south", "Probes": []}`)
+	require.NoError(t, err)
+	reencoded, err := codec.Encode(parsed)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 200, 50}, reencoded[:3])
+
+	_, err = codec.Encode(map[string]any{"temp": 20})
+	require.Error(t, err)
+
+	_, err = ResolveCodec(map[string]string{"type": "struct", MetadataSchema: "a:unknown"})
+	require.Error(t, err)
+
+	// schema must fit in metadata value
+	var structFields []reflect.StructField
+	for i := 0; i < 20; i++ {
+		structFields = append(structFields, reflect.StructField{Name: "Field" + strconv.Itoa(i), Type: reflect.TypeFor[string]()})
+	}
+	_, err = SchemaOf(reflect.StructOf(structFields))
+	require.Error(t, err)
+}
@@ -1,8 +1,13 @@
 package surp
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"math"
+	"reflect"
+	"time"
 )
 
 func EncodeString(v string) []byte {
@@ -55,38 +60,185 @@ func DecodeFloat(b []byte) (float64, bool) {
 	return math.Float64frombits(bits), true
 }
 
-func EncodeGeneric(v any, typ string) []byte {
-	switch typ {
-	case "string":
-		return EncodeString(v.(string))
+func EncodeInt8(v int8) []byte {
+	return []byte{byte(v)}
+}
+
+func DecodeInt8(b []byte) (int8, bool) {
+	if len(b) != 1 {
+		return 0, false
+	}
+	return int8(b[0]), true
+}
+
+func EncodeInt16(v int16) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(v))
+}
+
+func DecodeInt16(b []byte) (int16, bool) {
+	if len(b) != 2 {
+		return 0, false
+	}
+	return int16(binary.BigEndian.Uint16(b)), true
+}
+
+func EncodeInt32(v int32) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(v))
+}
+
+func DecodeInt32(b []byte) (int32, bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return int32(binary.BigEndian.Uint32(b)), true
+}
+
+func EncodeUint8(v uint8) []byte {
+	return []byte{v}
+}
+
+func DecodeUint8(b []byte) (uint8, bool) {
+	if len(b) != 1 {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func EncodeUint16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func DecodeUint16(b []byte) (uint16, bool) {
+	if len(b) != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b), true
+}
+
+func EncodeUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
 
-	case "int":
-		return EncodeInt(v.(int64))
+func DecodeUint32(b []byte) (uint32, bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b), true
+}
 
-	case "bool":
-		return EncodeBool(v.(bool))
+func EncodeUint64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
 
-	case "float":
-		return EncodeFloat(v.(float64))
+func DecodeUint64(b []byte) (uint64, bool) {
+	if len(b) != 8 {
+		return 0, false
 	}
+	return binary.BigEndian.Uint64(b), true
+}
 
-	return nil
+func EncodeFloat32(v float32) []byte {
+	return binary.BigEndian.AppendUint32(nil, math.Float32bits(v))
 }
 
-func DecodeGeneric(b []byte, typ string) (any, bool) {
-	switch typ {
-	case "string":
-		return DecodeString(b)
+func DecodeFloat32(b []byte) (float32, bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return math.Float32frombits(binary.BigEndian.Uint32(b)), true
+}
+
+func EncodeBytes(v []byte) []byte {
+	return v
+}
+
+func DecodeBytes(b []byte) ([]byte, bool) {
+	return bytes.Clone(b), true
+}
 
-	case "int":
-		return DecodeInt(b)
+// Range of times representable as Unix nanoseconds, about years 1678 to 2262.
+var (
+	MinTime = time.Unix(0, math.MinInt64)
+	MaxTime = time.Unix(0, math.MaxInt64)
+)
 
-	case "bool":
-		return DecodeBool(b)
+// Time is encoded as Unix nanoseconds in int encoding.
+// Returns error for times out of range of MinTime and MaxTime, including the zero time.
+func EncodeTime(v time.Time) ([]byte, error) {
+	if v.Before(MinTime) || v.After(MaxTime) {
+		return nil, fmt.Errorf("time %s out of range", v.Format(time.RFC3339))
+	}
+	return EncodeInt(v.UnixNano()), nil
+}
 
-	case "float":
-		return DecodeFloat(b)
+func DecodeTime(b []byte) (time.Time, bool) {
+	ns, ok := DecodeInt(b)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// Duration is encoded as nanoseconds in int encoding.
+func EncodeDuration(v time.Duration) []byte {
+	return EncodeInt(int64(v))
+}
+
+func DecodeDuration(b []byte) (time.Duration, bool) {
+	ns, ok := DecodeInt(b)
+	return time.Duration(ns), ok
+}
+
+func EncodeJSON[T any](v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func DecodeJSON[T any](b []byte) (T, bool) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err == nil
+}
+
+// Returns equality function comparing values by their encoded form,
+// suitable for types which are not comparable by ==.
+func EqualEncoded[T any](encoder func(T) ([]byte, error)) func(T, T) bool {
+	return func(a, b T) bool {
+		ea, err := encoder(a)
+		if err != nil {
+			return false
+		}
+		eb, err := encoder(b)
+		if err != nil {
+			return false
+		}
+		return bytes.Equal(ea, eb)
+	}
+}
+
+// Returns == for comparable types and comparison of encoded form for other types.
+// Types containing interfaces are compared by encoded form, since == could panic on them.
+func DefaultEqual[T any](encoder func(T) ([]byte, error)) func(T, T) bool {
+	if strictlyComparable(reflect.TypeFor[T]()) {
+		return func(a, b T) bool {
+			return any(a) == any(b)
+		}
+	}
+	return EqualEncoded(encoder)
+}
 
+func strictlyComparable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return false
+	case reflect.Array:
+		return strictlyComparable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !strictlyComparable(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
 	}
-	return nil, false
+	return t.Comparable()
 }
@@ -0,0 +1,64 @@
+package surp
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// Upper limit of decompressed message body, protects receivers from decompression bombs.
+const maxDecompressedSize = 0x10000 + MaxMessageSize
+
+var deflateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// Returns deflated body if it is smaller than the original one.
+func compressBody(body []byte) ([]byte, bool) {
+
+	var buf bytes.Buffer
+
+	w := deflateWriters.Get().(*flate.Writer)
+	defer deflateWriters.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, false
+	}
+	if err := w.Close(); err != nil {
+		return nil, false
+	}
+
+	if buf.Len() >= len(body) {
+		return nil, false
+	}
+
+	return buf.Bytes(), true
+}
+
+var deflateReaders = sync.Pool{
+	New: func() any {
+		return flate.NewReader(nil)
+	},
+}
+
+func decompressBody(body []byte) ([]byte, bool) {
+
+	r := deflateReaders.Get().(io.ReadCloser)
+	defer deflateReaders.Put(r)
+
+	if err := r.(flate.Resetter).Reset(bytes.NewReader(body), nil); err != nil {
+		return nil, false
+	}
+
+	result, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil || len(result) > maxDecompressedSize {
+		return nil, false
+	}
+
+	return result, true
+}
@@ -0,0 +1,151 @@
+package surp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Metadata keys of numeric range constraints.
+const (
+	MetadataMin   = "min"
+	MetadataMax   = "max"
+	MetadataStep  = "step"
+	MetadataClamp = "clamp"
+)
+
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+}
+
+// Policy applied by providers to values set out of the constraint.
+type ConstraintPolicy int
+
+const (
+	// Sets out of the constraint are ignored.
+	RejectOutOfRange ConstraintPolicy = iota
+	// Values are clamped to the range and rounded to the nearest step.
+	ClampOutOfRange
+)
+
+/*
+Constraint limits numeric register values to range [Min, Max], in multiples of Step counted from Min (or zero).
+
+Constraint is advertised in "min", "max" and "step" metadata keys,
+"clamp" key is "true" if out of range values are clamped instead of rejected.
+*/
+type Constraint[T Number] struct {
+	Min    Optional[T]
+	Max    Optional[T]
+	Step   Optional[T]
+	Policy ConstraintPolicy
+}
+
+// Relative tolerance of step check, since float values are rarely exact multiples.
+const stepTolerance = 1e-9
+
+// Parses constraint advertised in metadata, missing keys leave the bounds undefined.
+func ParseConstraint(metadata map[string]string) (Constraint[float64], error) {
+	c := Constraint[float64]{}
+	md := Metadata(metadata)
+
+	var err error
+	if c.Min, err = md.float(MetadataMin); err != nil {
+		return c, err
+	}
+	if c.Max, err = md.float(MetadataMax); err != nil {
+		return c, err
+	}
+	if c.Step, err = md.float(MetadataStep); err != nil {
+		return c, err
+	}
+	if metadata[MetadataClamp] == "true" {
+		c.Policy = ClampOutOfRange
+	}
+
+	return c, nil
+}
+
+// Writes the constraint to metadata.
+func (c Constraint[T]) Advertise(metadata map[string]string) {
+	format := func(v T) string {
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	}
+	if c.Min.IsDefined() {
+		metadata[MetadataMin] = format(c.Min.Get())
+	}
+	if c.Max.IsDefined() {
+		metadata[MetadataMax] = format(c.Max.Get())
+	}
+	if c.Step.IsDefined() {
+		metadata[MetadataStep] = format(c.Step.Get())
+	}
+	if c.Policy == ClampOutOfRange {
+		metadata[MetadataClamp] = "true"
+	}
+}
+
+// Returns error if the value does not satisfy the constraint, regardless of policy.
+func (c Constraint[T]) Check(v T) error {
+	f := float64(v)
+	if math.IsNaN(f) {
+		return fmt.Errorf("value %v is not a number", v)
+	}
+	if c.Min.IsDefined() && v < c.Min.Get() {
+		return fmt.Errorf("value %v is less than minimum %v", v, c.Min.Get())
+	}
+	if c.Max.IsDefined() && v > c.Max.Get() {
+		return fmt.Errorf("value %v is greater than maximum %v", v, c.Max.Get())
+	}
+	if c.Step.IsDefined() && c.Step.Get() > 0 {
+		step := float64(c.Step.Get())
+		n := (f - c.base()) / step
+		if math.Abs(n-math.Round(n)) > stepTolerance*math.Max(1, math.Abs(n)) {
+			return fmt.Errorf("value %v is not a multiple of step %v", v, c.Step.Get())
+		}
+	}
+	return nil
+}
+
+// Returns the value satisfying the constraint according to policy, or error if rejected.
+func (c Constraint[T]) Apply(v T) (T, error) {
+	err := c.Check(v)
+	if err == nil || c.Policy != ClampOutOfRange || math.IsNaN(float64(v)) {
+		return v, err
+	}
+
+	// computed in float64, so that rounding up to the step does not overflow T before clamping
+	f := float64(v)
+	if c.Step.IsDefined() && c.Step.Get() > 0 {
+		step := float64(c.Step.Get())
+		f = c.base() + math.Round((f-c.base())/step)*step
+	}
+	if c.Min.IsDefined() && f < float64(c.Min.Get()) {
+		return c.Min.Get(), nil
+	}
+	if c.Max.IsDefined() && f > float64(c.Max.Get()) {
+		return c.Max.Get(), nil
+	}
+	return T(f), nil
+}
+
+func (c Constraint[T]) base() float64 {
+	if c.Min.IsDefined() {
+		return float64(c.Min.Get())
+	}
+	return 0
+}
+
+// Checks value of any numeric type against constraint advertised in metadata.
+// Values are accepted if the provider clamps them or if they are not numeric.
+func CheckConstraint(v any, metadata map[string]string) error {
+	c, err := ParseConstraint(metadata)
+	if err != nil || c.Policy == ClampOutOfRange {
+		return nil
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return nil
+	}
+	return c.Check(f)
+}
@@ -0,0 +1,48 @@
+package surp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraint(t *testing.T) {
+
+	c := Constraint[int16]{Min: NewDefined[int16](10), Max: NewDefined[int16](100), Step: NewDefined[int16](5)}
+
+	require.NoError(t, c.Check(10))
+	require.NoError(t, c.Check(55))
+	require.NoError(t, c.Check(100))
+	require.ErrorContains(t, c.Check(5), "minimum")
+	require.ErrorContains(t, c.Check(105), "maximum")
+	require.ErrorContains(t, c.Check(12), "step")
+
+	_, err := c.Apply(12)
+	require.Error(t, err)
+
+	c.Policy = ClampOutOfRange
+	for in, out := range map[int16]int16{12: 10, 13: 15, -300: 10, 99: 100, 32767: 100} {
+		v, err := c.Apply(in)
+		require.NoError(t, err)
+		require.Equal(t, out, v, in)
+	}
+
+	metadata := map[string]string{}
+	c.Advertise(metadata)
+	require.Equal(t, map[string]string{"min": "10", "max": "100", "step": "5", "clamp": "true"}, metadata)
+
+	f := Constraint[float64]{Min: NewDefined(-0.5), Step: NewDefined(0.1)}
+	require.NoError(t, f.Check(0.3))
+	require.Error(t, f.Check(0.35))
+
+	parsed, err := ParseConstraint(map[string]string{"min": "-0.5", "step": "0.1"})
+	require.NoError(t, err)
+	require.Equal(t, f, parsed)
+
+	_, err = ParseConstraint(map[string]string{"max": "x"})
+	require.Error(t, err)
+
+	require.Error(t, CheckConstraint(int64(101), map[string]string{"max": "100"}))
+	require.NoError(t, CheckConstraint(int64(101), map[string]string{"max": "100", "clamp": "true"}))
+	require.NoError(t, CheckConstraint("abc", map[string]string{"max": "100"}))
+}
@@ -1,25 +1,86 @@
 package consumer
 
-import surp "github.com/burgrp/surp-go/pkg"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	surp "github.com/burgrp/surp-go/pkg"
+)
 
 type SyncListener[T any] func(surp.Optional[T])
 
-type Register[T comparable] struct {
+type MetadataListener func(surp.Metadata)
+
+// Policy applied when buffer of an Updates channel is full.
+type DropPolicy int
+
+const (
+	// Oldest buffered value is dropped, so the channel always ends with the latest value.
+	DropOldest DropPolicy = iota
+	// New value is dropped, buffered values are kept.
+	DropNewest
+)
+
+/*
+Register consumes value of type T from the group.
+
+Register is safe for concurrent use: application goroutines call GetValue, GetMetadata and SetValue,
+while the group calls SyncValue and SetMetadata from its dispatcher goroutines.
+Syncs are processed one at a time, sync listeners are called in order of syncs without internal lock held,
+a slow listener delays only further syncs of the same register.
+Alternatively, changes can be received from channels returned by Updates.
+*/
+type Register[T any] struct {
 	name          string
 	value         surp.Optional[T]
-	encoder       surp.Encoder[T]
+	encoder       func(T) ([]byte, error)
 	decoder       surp.Decoder[T]
-	metadata      surp.Optional[map[string]string]
+	equal         func(T, T) bool
+	metadata      surp.Optional[surp.Metadata]
 	syncListeners []SyncListener[T]
+	mdListeners   []MetadataListener
 	setListener   func(surp.Optional[[]byte])
 	firstSync     bool
+	updates       []*updates[T]
+	mutex         sync.Mutex
+
+	// serializes syncs, so that listeners see values in order
+	syncMutex sync.Mutex
+}
+
+type updates[T any] struct {
+	ch     chan surp.Optional[T]
+	policy DropPolicy
+}
+
+func NewRegister[T any](name string, encoder surp.Encoder[T], decoder surp.Decoder[T], listeners ...SyncListener[T]) *Register[T] {
+	return NewRegisterWithEqual(name, encoder, decoder, nil, listeners...)
 }
 
-func NewRegister[T comparable](name string, encoder surp.Encoder[T], decoder surp.Decoder[T], listeners ...SyncListener[T]) *Register[T] {
+// Creates register which uses the given function to detect value changes in SyncValue.
+// If equal is nil, values of comparable types are compared by ==, other values by their encoded form.
+func NewRegisterWithEqual[T any](name string, encoder surp.Encoder[T], decoder surp.Decoder[T], equal func(T, T) bool, listeners ...SyncListener[T]) *Register[T] {
+	return newRegister(name, func(v T) ([]byte, error) {
+		return encoder(v), nil
+	}, decoder, equal, listeners...)
+}
+
+func newRegister[T any](name string, encoder func(T) ([]byte, error), decoder surp.Decoder[T], equal func(T, T) bool, listeners ...SyncListener[T]) *Register[T] {
+	if equal == nil {
+		equal = surp.DefaultEqual(encoder)
+	}
+
 	consumer := &Register[T]{
 		name:          name,
 		encoder:       encoder,
 		decoder:       decoder,
+		equal:         equal,
 		syncListeners: listeners,
 		firstSync:     true,
 	}
@@ -31,12 +92,31 @@ func (reg *Register[T]) GetName() string {
 	return reg.name
 }
 
+// Returns copy of metadata synced by the provider, undefined if not synced yet.
 func (reg *Register[T]) GetMetadata() surp.Optional[map[string]string] {
-	return reg.metadata
+	md := reg.GetTypedMetadata()
+	if md.IsUndefined() {
+		return surp.NewUndefined[map[string]string]()
+	}
+	return surp.NewDefined(map[string]string(md.Get()))
+}
+
+// Same as GetMetadata, with accessors of standard keys.
+func (reg *Register[T]) GetTypedMetadata() surp.Optional[surp.Metadata] {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if reg.metadata.IsUndefined() {
+		return reg.metadata
+	}
+	return surp.NewDefined(surp.Metadata(reg.metadata.Get().Map()))
 }
 
 func (reg *Register[T]) SyncValue(encodedValue surp.Optional[[]byte]) {
+	reg.syncMutex.Lock()
+	defer reg.syncMutex.Unlock()
 
+	// decoder and equal may read metadata, so they are called without the lock held,
+	// value is written only here, so it can not change meanwhile
 	var newValue surp.Optional[T]
 	if encodedValue.IsDefined() {
 		ev, ok := reg.decoder(encodedValue.Get())
@@ -44,35 +124,137 @@ func (reg *Register[T]) SyncValue(encodedValue surp.Optional[[]byte]) {
 			newValue = surp.NewDefined(ev)
 		}
 	}
-	if newValue != reg.value || reg.firstSync {
+
+	reg.mutex.Lock()
+	oldValue, firstSync := reg.value, reg.firstSync
+	reg.mutex.Unlock()
+
+	changed := firstSync || !surp.EqualOptional(newValue, oldValue, reg.equal)
+
+	reg.mutex.Lock()
+	if changed {
 		reg.value = newValue
 		reg.firstSync = false
-		for _, listener := range reg.syncListeners {
-			listener(reg.value)
+		for _, u := range reg.updates {
+			u.send(newValue)
+		}
+	}
+	listeners := reg.syncListeners
+	reg.mutex.Unlock()
+
+	if changed {
+		for _, listener := range listeners {
+			listener(newValue)
+		}
+	}
+}
+
+/*
+Returns channel receiving value on every change, starting with the current value if already synced.
+
+Buffer is the channel capacity (at least 1), policy decides which value is dropped if the buffer is full.
+Values are sent without blocking, so a slow reader does not delay the group.
+The channel is never closed.
+*/
+func (reg *Register[T]) Updates(buffer int, policy DropPolicy) <-chan surp.Optional[T] {
+	u := &updates[T]{
+		ch:     make(chan surp.Optional[T], max(buffer, 1)),
+		policy: policy,
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	reg.updates = append(reg.updates, u)
+	if !reg.firstSync {
+		u.send(reg.value)
+	}
+
+	return u.ch
+}
+
+// Sends value without blocking, must be called with the register lock held.
+func (u *updates[T]) send(value surp.Optional[T]) {
+	for {
+		select {
+		case u.ch <- value:
+			return
+		default:
+		}
+
+		if u.policy == DropNewest {
+			return
+		}
+
+		// the reader may have emptied the buffer meanwhile, so the send is retried
+		select {
+		case <-u.ch:
+		default:
 		}
 	}
 }
 
 func (reg *Register[T]) Attach(setListener func(surp.Optional[[]byte])) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
 	reg.setListener = setListener
 }
 
 func (reg *Register[T]) GetValue() surp.Optional[T] {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
 	return reg.value
 }
 
-func (reg *Register[T]) SetValue(value surp.Optional[T]) {
-	if reg.setListener != nil {
+func (reg *Register[T]) SetValue(value surp.Optional[T]) error {
+	reg.mutex.Lock()
+	setListener := reg.setListener
+	metadata := reg.metadata
+	reg.mutex.Unlock()
+
+	if setListener != nil {
 		var encoded surp.Optional[[]byte]
 		if value.IsDefined() {
-			encoded = surp.NewDefined(reg.encoder(value.Get()))
+			// do not send sets the provider would reject
+			if metadata.IsDefined() {
+				if err := surp.CheckConstraint(value.Get(), metadata.Get()); err != nil {
+					return err
+				}
+			}
+			ev, err := reg.encoder(value.Get())
+			if err != nil {
+				return err
+			}
+			if len(ev) > surp.MaxValueSize {
+				return fmt.Errorf("value of %d bytes exceeds maximum of %d bytes", len(ev), surp.MaxValueSize)
+			}
+			encoded = surp.NewDefined(ev)
 		}
-		reg.setListener(encoded)
+		setListener(encoded)
 	}
+	return nil
 }
 
 func (reg *Register[T]) SetMetadata(md map[string]string) {
-	reg.metadata = surp.NewDefined(md)
+	reg.mutex.Lock()
+	changed := reg.metadata.IsUndefined() || !maps.Equal(reg.metadata.Get(), surp.Metadata(md))
+	reg.metadata = surp.NewDefined(surp.Metadata(md))
+	listeners := reg.mdListeners
+	reg.mutex.Unlock()
+
+	if changed {
+		for _, listener := range listeners {
+			listener(surp.Metadata(md).Map())
+		}
+	}
+}
+
+// Adds listener called with copy of metadata when it is first synced and whenever the provider changes it.
+// Metadata listeners are called before sync listeners of the value synced with the metadata.
+func (reg *Register[T]) OnMetadataChange(listener MetadataListener) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.mdListeners = append(reg.mdListeners, listener)
 }
 
 func NewStringRegister(name string, listeners ...SyncListener[string]) *Register[string] {
@@ -91,23 +273,173 @@ func NewFloatRegister(name string, listeners ...SyncListener[float64]) *Register
 	return NewRegister[float64](name, surp.EncodeFloat, surp.DecodeFloat, listeners...)
 }
 
+func NewInt8Register(name string, listeners ...SyncListener[int8]) *Register[int8] {
+	return NewRegister[int8](name, surp.EncodeInt8, surp.DecodeInt8, listeners...)
+}
+
+func NewInt16Register(name string, listeners ...SyncListener[int16]) *Register[int16] {
+	return NewRegister[int16](name, surp.EncodeInt16, surp.DecodeInt16, listeners...)
+}
+
+func NewInt32Register(name string, listeners ...SyncListener[int32]) *Register[int32] {
+	return NewRegister[int32](name, surp.EncodeInt32, surp.DecodeInt32, listeners...)
+}
+
+func NewUint8Register(name string, listeners ...SyncListener[uint8]) *Register[uint8] {
+	return NewRegister[uint8](name, surp.EncodeUint8, surp.DecodeUint8, listeners...)
+}
+
+func NewUint16Register(name string, listeners ...SyncListener[uint16]) *Register[uint16] {
+	return NewRegister[uint16](name, surp.EncodeUint16, surp.DecodeUint16, listeners...)
+}
+
+func NewUint32Register(name string, listeners ...SyncListener[uint32]) *Register[uint32] {
+	return NewRegister[uint32](name, surp.EncodeUint32, surp.DecodeUint32, listeners...)
+}
+
+func NewUint64Register(name string, listeners ...SyncListener[uint64]) *Register[uint64] {
+	return NewRegister[uint64](name, surp.EncodeUint64, surp.DecodeUint64, listeners...)
+}
+
+func NewFloat32Register(name string, listeners ...SyncListener[float32]) *Register[float32] {
+	return NewRegister[float32](name, surp.EncodeFloat32, surp.DecodeFloat32, listeners...)
+}
+
+func NewBytesRegister(name string, listeners ...SyncListener[[]byte]) *Register[[]byte] {
+	return NewRegisterWithEqual(name, surp.EncodeBytes, surp.DecodeBytes, bytes.Equal, listeners...)
+}
+
+func NewTimeRegister(name string, listeners ...SyncListener[time.Time]) *Register[time.Time] {
+	return newRegister(name, surp.EncodeTime, surp.DecodeTime, time.Time.Equal, listeners...)
+}
+
+func NewDurationRegister(name string, listeners ...SyncListener[time.Duration]) *Register[time.Duration] {
+	return NewRegister[time.Duration](name, surp.EncodeDuration, surp.DecodeDuration, listeners...)
+}
+
+func NewArrayRegister[T comparable](name string, elemType string, listeners ...SyncListener[[]T]) *Register[[]T] {
+	return newRegister(name, func(v []T) ([]byte, error) {
+		return surp.EncodeArray(v, elemType)
+	}, func(b []byte) ([]T, bool) {
+		return surp.DecodeArray[T](b, elemType)
+	}, slices.Equal[[]T], listeners...)
+}
+
+func NewIntArrayRegister(name string, listeners ...SyncListener[[]int64]) *Register[[]int64] {
+	return NewArrayRegister(name, "int", listeners...)
+}
+
+func NewFloatArrayRegister(name string, listeners ...SyncListener[[]float64]) *Register[[]float64] {
+	return NewArrayRegister(name, "float", listeners...)
+}
+
+func NewBoolArrayRegister(name string, listeners ...SyncListener[[]bool]) *Register[[]bool] {
+	return NewArrayRegister(name, "bool", listeners...)
+}
+
+func NewStringArrayRegister(name string, listeners ...SyncListener[[]string]) *Register[[]string] {
+	return NewArrayRegister(name, "string", listeners...)
+}
+
 func NewAnyRegister(name string, listeners ...SyncListener[any]) *Register[any] {
+	return newCodecRegister(name, listeners...)
+}
+
+// Creates register with symbol of enum advertised by the provider as value.
+func NewEnumRegister(name string, listeners ...SyncListener[string]) *Register[string] {
+	return newCodecRegister(name, listeners...)
+}
+
+// Creates register of float64 engineering value, scaled according to metadata advertised by the provider.
+// Integer registers without scale metadata are accepted as unscaled.
+func NewScaledRegister(name string, listeners ...SyncListener[float64]) *Register[float64] {
 
-	var reg *Register[any]
+	var reg *Register[float64]
 
-	getType := func() string {
+	getScale := func() (string, float64, float64, error) {
 		omd := reg.GetMetadata()
-		if omd.IsDefined() {
-			return omd.Get()["type"]
+		if omd.IsUndefined() {
+			return "", 0, 0, errors.New("metadata of register " + name + " not synced yet")
 		}
-		return ""
+		typ := omd.Get()["type"]
+		scale, offset, _, err := surp.ParseScale(omd.Get())
+		if err == nil {
+			err = surp.ValidateScaled(typ, scale, offset)
+		}
+		return typ, scale, offset, err
 	}
 
-	reg = NewRegister[any](name, func(value any) []byte {
-		return surp.EncodeGeneric(value, getType())
-	}, func(b []byte) (any, bool) {
-		return surp.DecodeGeneric(b, getType())
-	}, listeners...)
+	reg = newRegister(name, func(v float64) ([]byte, error) {
+		typ, scale, offset, err := getScale()
+		if err != nil {
+			return nil, err
+		}
+		return surp.EncodeScaled(v, typ, scale, offset)
+	}, func(b []byte) (float64, bool) {
+		typ, scale, offset, err := getScale()
+		if err != nil {
+			return 0, false
+		}
+		return surp.DecodeScaled(b, typ, scale, offset)
+	}, nil, listeners...)
 
 	return reg
 }
+
+// Creates register encoded by codec resolved from metadata synced by the provider.
+func newCodecRegister[T any](name string, listeners ...SyncListener[T]) *Register[T] {
+
+	var reg *Register[T]
+
+	getCodec := func() (*surp.Codec, error) {
+		omd := reg.GetMetadata()
+		if omd.IsUndefined() {
+			return nil, errors.New("metadata of register " + name + " not synced yet")
+		}
+		return surp.ResolveCodec(omd.Get())
+	}
+
+	encoder := func(value T) ([]byte, error) {
+		codec, err := getCodec()
+		if err != nil {
+			return nil, err
+		}
+		return codec.Encode(value)
+	}
+
+	reg = newRegister[T](name, encoder, func(b []byte) (T, bool) {
+		var result T
+		codec, err := getCodec()
+		if err != nil {
+			return result, false
+		}
+		value, ok := codec.Decode(b)
+		if !ok {
+			return result, false
+		}
+		result, ok = value.(T)
+		return result, ok
+	}, nil, listeners...)
+
+	return reg
+}
+
+func NewJSONRegister[T any](name string, listeners ...SyncListener[T]) *Register[T] {
+	return newRegister(name, surp.EncodeJSON[T], surp.DecodeJSON[T], nil, listeners...)
+}
+
+// Creates register of self-describing value, decoded to nil, bool, int64, uint64, float64, string, []byte, []any or map[string]any.
+func NewCBORRegister(name string, listeners ...SyncListener[any]) *Register[any] {
+	return newRegister(name, surp.EncodeCBOR, surp.DecodeCBOR, nil, listeners...)
+}
+
+// Creates register of struct type T, with schema derived from the struct fields and their surp tags.
+// Panics if the struct can not be described by schema.
+func NewStructRegister[T any](name string, listeners ...SyncListener[T]) *Register[T] {
+
+	if _, err := surp.SchemaOf(reflect.TypeFor[T]()); err != nil {
+		panic(err)
+	}
+
+	return newRegister(name, surp.EncodeStruct[T], surp.DecodeStruct[T], nil, listeners...)
+}
@@ -0,0 +1,141 @@
+package consumer_test
+
+import (
+	"sync"
+	"testing"
+
+	surp "github.com/burgrp/surp-go/pkg"
+	"github.com/burgrp/surp-go/pkg/consumer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdates(t *testing.T) {
+
+	reg := consumer.NewIntRegister("counter")
+
+	latest := reg.Updates(2, consumer.DropOldest)
+	first := reg.Updates(2, consumer.DropNewest)
+
+	for i := int64(1); i <= 4; i++ {
+		reg.SyncValue(surp.NewDefined(surp.EncodeInt(i)))
+	}
+
+	require.Equal(t, surp.NewDefined[int64](3), <-latest)
+	require.Equal(t, surp.NewDefined[int64](4), <-latest)
+	require.Equal(t, surp.NewDefined[int64](1), <-first)
+	require.Equal(t, surp.NewDefined[int64](2), <-first)
+
+	// unchanged value is not delivered
+	reg.SyncValue(surp.NewDefined(surp.EncodeInt(4)))
+	require.Empty(t, latest)
+
+	reg.SyncValue(surp.NewUndefined[[]byte]())
+	require.Equal(t, surp.NewUndefined[int64](), <-latest)
+
+	// late subscriber receives the current value
+	late := reg.Updates(0, consumer.DropOldest)
+	require.Equal(t, surp.NewUndefined[int64](), <-late)
+}
+
+// Run with -race to detect unsynchronized access.
+func TestConcurrentAccess(t *testing.T) {
+
+	var listened []int64
+	reg := consumer.NewAnyRegister("counter", func(value surp.Optional[any]) {
+		listened = append(listened, value.Get().(int64))
+	})
+
+	reg.SetMetadata(map[string]string{"type": "int", "max": "1000000"})
+
+	var sets [][]byte
+	var setsMutex sync.Mutex
+	reg.Attach(func(value surp.Optional[[]byte]) {
+		setsMutex.Lock()
+		defer setsMutex.Unlock()
+		sets = append(sets, value.Get())
+	})
+
+	updates := reg.Updates(10, consumer.DropOldest)
+
+	const n = 1000
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= n; i++ {
+			reg.SyncValue(surp.NewDefined(surp.EncodeInt(int64(i))))
+			if i%100 == 0 {
+				reg.SetMetadata(map[string]string{"type": "int", "max": "1000000"})
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			reg.GetValue()
+			md := reg.GetMetadata()
+			md.Get()["local"] = "modified"
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			if err := reg.SetValue(surp.NewDefined[any](int64(i))); err != nil {
+				errs <- err
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	require.Len(t, listened, n)
+	for i, v := range listened {
+		require.Equal(t, int64(i+1), v)
+	}
+	require.Len(t, sets, n)
+	require.NotContains(t, reg.GetMetadata().Get(), "local")
+	require.Error(t, reg.SetValue(surp.NewDefined[any](int64(1000001))))
+
+	var last surp.Optional[any]
+	for len(updates) > 0 {
+		last = <-updates
+	}
+	require.Equal(t, surp.NewDefined[any](int64(n)), last)
+}
+
+func TestMetadataChange(t *testing.T) {
+
+	var values []surp.Optional[int64]
+	reg := consumer.NewIntRegister("counter", func(value surp.Optional[int64]) {
+		values = append(values, value)
+	})
+
+	var changes []surp.Metadata
+	reg.OnMetadataChange(func(md surp.Metadata) {
+		changes = append(changes, md)
+	})
+
+	reg.SetMetadata(map[string]string{surp.MetadataType: "int"})
+	reg.SyncValue(surp.NewDefined(surp.EncodeInt(1)))
+	reg.SetMetadata(map[string]string{surp.MetadataType: "int"})
+	reg.SyncValue(surp.NewDefined(surp.EncodeInt(1)))
+	reg.SetMetadata(map[string]string{surp.MetadataType: "int", surp.MetadataUnit: "pcs"})
+	reg.SyncValue(surp.NewDefined(surp.EncodeInt(1)))
+
+	require.Equal(t, []surp.Metadata{
+		{surp.MetadataType: "int"},
+		{surp.MetadataType: "int", surp.MetadataUnit: "pcs"},
+	}, changes)
+	require.Equal(t, []surp.Optional[int64]{surp.NewDefined(int64(1))}, values)
+	require.Equal(t, "pcs", reg.GetTypedMetadata().Get().Unit())
+	require.Equal(t, "pcs", reg.GetMetadata().Get()[surp.MetadataUnit])
+}
@@ -0,0 +1,128 @@
+package surp
+
+import (
+	"sync"
+)
+
+// Parameters of dispatching of received messages to registers and listeners.
+const (
+	DispatchWorkers   = 4
+	DispatchQueueSize = 64
+)
+
+/*
+Dispatcher runs listener calls off the network reader goroutine, so that slow listeners
+do not stall processing of received messages and listeners may call back into the group.
+
+Tasks are queued by key (e.g. register name), tasks of the same key run one at a time in order,
+tasks of different keys run in parallel on a pool of workers.
+If a queue is full, its oldest task is dropped, since later syncs supersede earlier ones.
+*/
+type dispatcher struct {
+	queueSize int
+
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	queues    map[string]*dispatchQueue
+	ready     []*dispatchQueue
+	overflows map[string]uint64
+	closed    bool
+}
+
+type dispatchQueue struct {
+	key   string
+	tasks []func()
+}
+
+func newDispatcher(workers int, queueSize int) *dispatcher {
+	d := &dispatcher{
+		queueSize: queueSize,
+		queues:    map[string]*dispatchQueue{},
+		overflows: map[string]uint64{},
+	}
+	d.cond = sync.NewCond(&d.mutex)
+
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+
+	return d
+}
+
+func (d *dispatcher) dispatch(key string, task func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	// queue exists while it has tasks queued or running
+	q, ok := d.queues[key]
+	if !ok {
+		q = &dispatchQueue{key: key}
+		d.queues[key] = q
+		d.ready = append(d.ready, q)
+		d.cond.Signal()
+	}
+
+	if len(q.tasks) >= d.queueSize {
+		q.tasks = q.tasks[1:]
+		d.overflows[key]++
+	}
+
+	q.tasks = append(q.tasks, task)
+}
+
+func (d *dispatcher) work() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for {
+		for len(d.ready) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if d.closed {
+			return
+		}
+
+		q := d.ready[0]
+		d.ready = d.ready[1:]
+
+		task := q.tasks[0]
+		q.tasks = q.tasks[1:]
+
+		d.mutex.Unlock()
+		task()
+		d.mutex.Lock()
+
+		if len(q.tasks) > 0 {
+			d.ready = append(d.ready, q)
+		} else {
+			delete(d.queues, q.key)
+		}
+	}
+}
+
+// Returns number of tasks dropped by key, since their queue was full.
+func (d *dispatcher) getOverflows() map[string]uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	overflows := make(map[string]uint64, len(d.overflows))
+	for k, v := range d.overflows {
+		overflows[k] = v
+	}
+	return overflows
+}
+
+// Stops workers, queued tasks are dropped and running tasks finish.
+func (d *dispatcher) close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.closed = true
+	d.queues = map[string]*dispatchQueue{}
+	d.ready = nil
+	d.cond.Broadcast()
+}
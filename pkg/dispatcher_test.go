@@ -0,0 +1,176 @@
+package surp
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testConsumer struct {
+	name     string
+	listener func(Optional[[]byte])
+}
+
+func (c *testConsumer) GetName() string {
+	return c.name
+}
+
+func (c *testConsumer) SetMetadata(map[string]string) {
+}
+
+func (c *testConsumer) SyncValue(value Optional[[]byte]) {
+	c.listener(value)
+}
+
+func (c *testConsumer) Attach(func(Optional[[]byte])) {
+}
+
+func TestDispatcherOrder(t *testing.T) {
+
+	d := newDispatcher(4, 1000)
+	defer d.close()
+
+	var mutex sync.Mutex
+	results := map[string][]int{}
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b", "c"} {
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			d.dispatch(key, func() {
+				defer wg.Done()
+				mutex.Lock()
+				defer mutex.Unlock()
+				results[key] = append(results[key], i)
+			})
+		}
+	}
+	wg.Wait()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.Len(t, results[key], 100)
+		for i, v := range results[key] {
+			require.Equal(t, i, v)
+		}
+	}
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+
+	d := newDispatcher(1, 2)
+	defer d.close()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.dispatch("slow", func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var executed []int
+	done := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		d.dispatch("slow", func() {
+			executed = append(executed, i)
+			if i == 4 {
+				close(done)
+			}
+		})
+	}
+
+	require.Equal(t, map[string]uint64{"slow": 3}, d.getOverflows())
+
+	close(release)
+	<-done
+	require.Equal(t, []int{3, 4}, executed)
+}
+
+func TestSlowListenerDoesNotBlockOthers(t *testing.T) {
+
+	group, _ := newTestGroup()
+
+	release := make(chan struct{})
+	slow := &testConsumer{name: "slow", listener: func(Optional[[]byte]) {
+		<-release
+	}}
+
+	fast := make(chan Optional[[]byte], 1)
+	require.NoError(t, group.AddConsumers(slow, &testConsumer{name: "fast", listener: func(value Optional[[]byte]) {
+		fast <- value
+	}}))
+
+	deliver(group, &Message{Type: MessageTypeSync, Name: "slow", Value: NewDefined(EncodeInt(1))})
+	deliver(group, &Message{Type: MessageTypeSync, Name: "fast", Value: NewDefined(EncodeInt(2))})
+
+	select {
+	case value := <-fast:
+		require.Equal(t, NewDefined(EncodeInt(2)), value)
+	case <-time.After(time.Second):
+		require.FailNow(t, "fast consumer blocked by slow one")
+	}
+
+	close(release)
+}
+
+func TestReentrantListener(t *testing.T) {
+
+	group, _ := newTestGroup()
+
+	added := make(chan Optional[[]byte], 1)
+	require.NoError(t, group.AddConsumers(&testConsumer{name: "first", listener: func(Optional[[]byte]) {
+		// adding consumers from listener would deadlock if the listener held the group lock
+		require.NoError(t, group.AddConsumers(&testConsumer{name: "second", listener: func(value Optional[[]byte]) {
+			added <- value
+		}}))
+	}}))
+
+	synced := make(chan string, 10)
+	group.OnSync(func(message *Message) {
+		group.OnSync(nil)
+		synced <- message.Name
+	})
+
+	deliver(group, &Message{Type: MessageTypeSync, Name: "first", Value: NewDefined(EncodeInt(1))})
+	require.Equal(t, "first", <-synced)
+
+	require.Eventually(t, func() bool {
+		deliver(group, &Message{Type: MessageTypeSync, Name: "second", Value: NewDefined(EncodeInt(2))})
+		return len(added) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, NewDefined(EncodeInt(2)), <-added)
+}
+
+func TestSyncListenerPerRegister(t *testing.T) {
+
+	group, _ := newTestGroup()
+	defer group.dispatcher.close()
+
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	synced := map[string]bool{}
+	group.OnSync(func(message *Message) {
+		<-release
+		mutex.Lock()
+		defer mutex.Unlock()
+		synced[message.Name] = true
+	})
+
+	// a burst of syncs of different registers does not overflow a shared queue
+	const n = DispatchQueueSize * 2
+	for i := 0; i < n; i++ {
+		deliver(group, &Message{Type: MessageTypeSync, Name: fmt.Sprintf("reg%d", i), Value: NewDefined(EncodeInt(int64(i)))})
+	}
+	close(release)
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(synced) == n
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, group.DroppedMessages())
+}
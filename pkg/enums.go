@@ -0,0 +1,113 @@
+package surp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Metadata key listing symbols of enum registers.
+const MetadataEnum = "enum"
+
+// Maximum number of enum symbols, given by the index encoding.
+const MaxEnumSymbols = 256
+
+/*
+Enum Encoding (Binary):
+
+	Index of the symbol as uint8.
+
+Symbols are advertised in "enum" metadata key as comma separated list, e.g. "off,auto,manual",
+which is limited to MaxStringSize bytes like any metadata value.
+*/
+
+// Checks symbols before they are advertised, symbols containing comma would be split.
+func ValidateEnumSymbols(symbols []string) error {
+	for _, symbol := range symbols {
+		if strings.Contains(symbol, ",") {
+			return fmt.Errorf("enum symbol contains comma: %s", symbol)
+		}
+	}
+	_, err := ParseEnumSymbols(strings.Join(symbols, ","))
+	return err
+}
+
+func ParseEnumSymbols(s string) ([]string, error) {
+	if s == "" {
+		return nil, errors.New("enum has no symbols")
+	}
+
+	// symbols are advertised in one metadata value
+	if len(s) > MaxStringSize {
+		return nil, fmt.Errorf("enum symbols take %d bytes, maximum is %d", len(s), MaxStringSize)
+	}
+
+	symbols := strings.Split(s, ",")
+	if len(symbols) > MaxEnumSymbols {
+		return nil, fmt.Errorf("enum has %d symbols, maximum is %d", len(symbols), MaxEnumSymbols)
+	}
+
+	seen := map[string]bool{}
+	for _, symbol := range symbols {
+		if symbol == "" {
+			return nil, errors.New("enum has empty symbol")
+		}
+		if seen[symbol] {
+			return nil, fmt.Errorf("duplicate enum symbol: %s", symbol)
+		}
+		seen[symbol] = true
+	}
+
+	return symbols, nil
+}
+
+func EncodeEnum(v string, symbols []string) ([]byte, error) {
+	for i, symbol := range symbols {
+		if symbol == v {
+			return EncodeUint8(uint8(i)), nil
+		}
+	}
+	return nil, enumError(v, symbols)
+}
+
+func DecodeEnum(b []byte, symbols []string) (string, bool) {
+	i, ok := DecodeUint8(b)
+	if !ok || int(i) >= len(symbols) {
+		return "", false
+	}
+	return symbols[i], true
+}
+
+func enumError(v string, symbols []string) error {
+	return fmt.Errorf("invalid value %q, expected one of: %s", v, strings.Join(symbols, ", "))
+}
+
+func init() {
+	RegisterCodecFactory("enum", func(metadata map[string]string) (*Codec, error) {
+
+		symbols, err := ParseEnumSymbols(metadata[MetadataEnum])
+		if err != nil {
+			return nil, err
+		}
+
+		return &Codec{
+			Encode: func(v any) ([]byte, error) {
+				s, ok := v.(string)
+				if !ok {
+					return nil, typeError(v, "enum")
+				}
+				return EncodeEnum(s, symbols)
+			},
+			Decode: func(b []byte) (any, bool) {
+				return DecodeEnum(b, symbols)
+			},
+			Parse: func(s string) (any, error) {
+				if _, err := EncodeEnum(s, symbols); err != nil {
+					return nil, err
+				}
+				return s, nil
+			},
+			Format: formatAny,
+		}, nil
+	})
+}
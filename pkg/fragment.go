@@ -0,0 +1,177 @@
+package surp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Incomplete messages are discarded after this time since their first fragment.
+	FragmentTimeout = 2 * time.Second
+
+	maxFragmentCount = 255
+
+	// Upper limit of memory occupied by incomplete messages of a group,
+	// which is the largest message that can be fragmented, enough for value of MaxValueSize.
+	MaxReassemblySize = maxFragmentCount * MaxMessageSize
+)
+
+/*
+Fragment Structure (Binary), follows the message header with FlagFragment set:
+
+	[1 byte]  Fragment index (0..count-1)
+	[1 byte]  Fragment count
+	[* bytes] Chunk of the message body (value and metadata), up to the end of datagram
+*/
+type fragment struct {
+	index byte
+	count byte
+	chunk []byte
+}
+
+func fragmentMessage(msg *Message, flags byte, body []byte) ([][]byte, bool) {
+
+	var header bytes.Buffer
+	writeHeader(msg, flags|FlagFragment, &header)
+
+	chunkSize := MaxMessageSize - header.Len() - 2
+	if chunkSize <= 0 {
+		return nil, false
+	}
+
+	count := (len(body) + chunkSize - 1) / chunkSize
+	if count > maxFragmentCount {
+		return nil, false
+	}
+
+	fragments := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := body[i*chunkSize : min((i+1)*chunkSize, len(body))]
+
+		var buf bytes.Buffer
+		buf.Write(header.Bytes())
+		buf.WriteByte(byte(i))
+		buf.WriteByte(byte(count))
+		buf.Write(chunk)
+		fragments = append(fragments, buf.Bytes())
+	}
+
+	return fragments, true
+}
+
+func readFragment(remaining *[]byte) (*fragment, bool) {
+
+	index, ok := readByte(remaining)
+	if !ok {
+		return nil, false
+	}
+
+	count, ok := readByte(remaining)
+	if !ok || index >= count {
+		return nil, false
+	}
+
+	f := &fragment{
+		index: index,
+		count: count,
+		chunk: *remaining,
+	}
+	*remaining = nil
+
+	return f, true
+}
+
+type pendingMessage struct {
+	chunks   [][]byte
+	received int
+	size     int
+	started  time.Time
+}
+
+type reassembler struct {
+	pending map[string]*pendingMessage
+	size    int
+	mutex   sync.Mutex
+}
+
+func newReassembler() *reassembler {
+	return &reassembler{
+		pending: make(map[string]*pendingMessage),
+	}
+}
+
+// Adds a fragment and returns the complete message once all its fragments arrived.
+func (r *reassembler) add(addr *net.UDPAddr, msg *Message) (*Message, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+
+	f := msg.fragment
+	key := fmt.Sprintf("%s/%d/%d/%s", addr, msg.Type, msg.SequenceNumber, msg.Name)
+
+	pending := r.pending[key]
+	if pending == nil {
+		pending = &pendingMessage{
+			chunks:  make([][]byte, f.count),
+			started: now,
+		}
+		r.pending[key] = pending
+	}
+
+	if len(pending.chunks) != int(f.count) || pending.chunks[f.index] != nil {
+		return nil, false
+	}
+
+	if r.size+len(f.chunk) > MaxReassemblySize {
+		r.remove(key)
+		return nil, false
+	}
+
+	pending.chunks[f.index] = f.chunk
+	pending.received++
+	pending.size += len(f.chunk)
+	r.size += len(f.chunk)
+
+	if pending.received < len(pending.chunks) {
+		return nil, false
+	}
+
+	r.remove(key)
+
+	body := bytes.Join(pending.chunks, nil)
+
+	complete := &Message{
+		Version:        msg.Version,
+		Flags:          msg.Flags &^ FlagFragment,
+		SequenceNumber: msg.SequenceNumber,
+		Type:           msg.Type,
+		Group:          msg.Group,
+		Name:           msg.Name,
+	}
+
+	if !decodeBody(complete, body) {
+		return nil, false
+	}
+
+	return complete, true
+}
+
+func (r *reassembler) expire(now time.Time) {
+	for key, pending := range r.pending {
+		if now.Sub(pending.started) > FragmentTimeout {
+			r.remove(key)
+		}
+	}
+}
+
+func (r *reassembler) remove(key string) {
+	if pending, ok := r.pending[key]; ok {
+		r.size -= pending.size
+		delete(r.pending, key)
+	}
+}
@@ -3,60 +3,171 @@ package surp
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 )
 
 const magicString = "SURP"
 
+const (
+	// Highest protocol version this implementation understands.
+	// Version 0 is the original format, version 1 adds a flags byte after the message type.
+	ProtocolVersion = 1
+
+	messageTypeMask = 0x0F
+	versionShift    = 4
+
+	// Flags of version 1 messages.
+	FlagFragment   = 0x01
+	FlagCompressed = 0x02
+
+	// Messages larger than this are fragmented toward peers supporting fragmentation.
+	MaxMessageSize = 512
+
+	// Longest encoded value, since length 0xFFFF marks undefined value.
+	MaxValueSize = 0xFFFE
+
+	// Longest group name, register name, metadata key or metadata value, and most metadata entries,
+	// since their lengths are encoded in one byte.
+	MaxStringSize   = 0xFF
+	MaxMetadataSize = 0xFF
+)
+
 type Message struct {
+	Version        byte
+	Flags          byte
 	SequenceNumber uint16
 	Type           byte
 	Group          string
 	Name           string
 	Value          Optional[[]byte]
 	Metadata       map[string]string
+
+	fragment *fragment
 }
 
-func encodeMessage(msg *Message) []byte {
+// Encodes the message using only the given features, which must be supported by the recipient.
+// Version 1 header is used only if some flags are set, otherwise the message is kept
+// in the original format so that legacy peers can decode it.
+// The body is compressed if the recipient supports it and it reduces the size.
+// Returns one datagram, or several fragments if the message exceeds MaxMessageSize,
+// error if the message can not be represented, e.g. its value is longer than MaxValueSize.
+func encodeMessage(msg *Message, features Capabilities) ([][]byte, error) {
+
+	if len(msg.Group) > MaxStringSize || len(msg.Name) > MaxStringSize {
+		return nil, fmt.Errorf("group or register name %s:%s exceeds %d bytes", msg.Group, msg.Name, MaxStringSize)
+	}
+
 	var buf bytes.Buffer
+	if err := writeBody(msg, &buf); err != nil {
+		return nil, err
+	}
+	body := buf.Bytes()
+
+	flags := msg.Flags
+	if !features.Has(CapabilityVersion1) {
+		flags = 0
+	}
+
+	if features.Has(CapabilityVersion1) && features.Has(CapabilityDeflate) && len(body) > 0 {
+		compressed, ok := compressBody(body)
+		if ok {
+			body = compressed
+			flags |= FlagCompressed
+		}
+	}
+
+	var header bytes.Buffer
+	writeHeader(msg, flags, &header)
+
+	if header.Len()+len(body) > MaxMessageSize && features.Has(CapabilityVersion1) && features.Has(CapabilityFragmentation) {
+		fragments, ok := fragmentMessage(msg, flags, body)
+		if ok {
+			return fragments, nil
+		}
+	}
+
+	header.Write(body)
+	return [][]byte{header.Bytes()}, nil
+}
+
+func writeHeader(msg *Message, flags byte, buf *bytes.Buffer) {
+
+	version := byte(0)
+	if flags != 0 {
+		version = 1
+	}
 
 	buf.WriteString(magicString)
-	buf.WriteByte(msg.Type)
-	binary.Write(&buf, binary.BigEndian, msg.SequenceNumber)
+	buf.WriteByte(version<<versionShift | msg.Type&messageTypeMask)
+	if version > 0 {
+		buf.WriteByte(flags)
+	}
+	binary.Write(buf, binary.BigEndian, msg.SequenceNumber)
 	buf.WriteByte(byte(len(msg.Group)))
 	buf.WriteString(msg.Group)
 	buf.WriteByte(byte(len(msg.Name)))
 	buf.WriteString(msg.Name)
+}
+
+func writeBody(msg *Message, buf *bytes.Buffer) error {
 
 	if msg.Type == MessageTypeSync || msg.Type == MessageTypeSet {
 
-		writeValue(msg.Value, &buf)
+		if err := writeValue(msg.Value, buf); err != nil {
+			return fmt.Errorf("register %s: %w", msg.Name, err)
+		}
 
 		if msg.Type == MessageTypeSync {
-
-			buf.WriteByte(byte(len(msg.Metadata)))
-			for k, v := range msg.Metadata {
-				buf.WriteByte(byte(len(k)))
-				buf.WriteString(k)
-				buf.WriteByte(byte(len(v)))
-				buf.WriteString(v)
+			if err := writeMetadata(msg.Metadata, buf); err != nil {
+				return fmt.Errorf("register %s: %w", msg.Name, err)
 			}
 		}
 	}
-	return buf.Bytes()
+
+	// legacy decoders stop reading after the register name of a get message,
+	// so the metadata may be appended to advertise capabilities of the consumer
+	if msg.Type == MessageTypeGet && len(msg.Metadata) > 0 {
+		if err := writeMetadata(msg.Metadata, buf); err != nil {
+			return fmt.Errorf("register %s: %w", msg.Name, err)
+		}
+	}
+
+	return nil
 }
 
-func writeValue(value Optional[[]byte], buf *bytes.Buffer) {
+func writeMetadata(metadata map[string]string, buf *bytes.Buffer) error {
+	if len(metadata) > MaxMetadataSize {
+		return fmt.Errorf("%d metadata entries exceed maximum of %d", len(metadata), MaxMetadataSize)
+	}
+	buf.WriteByte(byte(len(metadata)))
+	for k, v := range metadata {
+		if len(k) > MaxStringSize || len(v) > MaxStringSize {
+			return fmt.Errorf("metadata %s exceeds %d bytes", k, MaxStringSize)
+		}
+		buf.WriteByte(byte(len(k)))
+		buf.WriteString(k)
+		buf.WriteByte(byte(len(v)))
+		buf.WriteString(v)
+	}
+	return nil
+}
+
+func writeValue(value Optional[[]byte], buf *bytes.Buffer) error {
 	var length int
 	var data []byte
 
 	if value.IsDefined() {
 		data = value.Get()
 		length = len(data)
+		if length > MaxValueSize {
+			return fmt.Errorf("value of %d bytes exceeds maximum of %d bytes", length, MaxValueSize)
+		}
 	} else {
 		length = -1
 	}
 	binary.Write(buf, binary.BigEndian, uint16(length))
 	buf.Write(data)
+	return nil
 }
 
 func readByte(remaining *[]byte) (byte, bool) {
@@ -111,18 +222,58 @@ func readValue(remaining *[]byte) (Optional[[]byte], bool) {
 	return value, true
 }
 
+func readMetadata(remaining *[]byte) (map[string]string, bool) {
+
+	metadataCount, ok := readByte(remaining)
+	if !ok {
+		return nil, false
+	}
+
+	metadata := make(map[string]string, metadataCount)
+
+	for j := 0; j < int(metadataCount); j++ {
+
+		key, ok := readString(remaining)
+		if !ok {
+			return nil, false
+		}
+
+		val, ok := readString(remaining)
+		if !ok {
+			return nil, false
+		}
+
+		metadata[key] = val
+	}
+
+	return metadata, true
+}
+
 func decodeMessage(data []byte) (*Message, bool) {
 
 	remaining := data[:]
 
 	msg := &Message{}
 
-	var ok bool
-	msg.Type, ok = readByte(&remaining)
+	typeAndVersion, ok := readByte(&remaining)
 	if !ok {
 		return nil, false
 	}
 
+	msg.Type = typeAndVersion & messageTypeMask
+	msg.Version = typeAndVersion >> versionShift
+
+	if msg.Version > ProtocolVersion {
+		return nil, false
+	}
+
+	if msg.Version > 0 {
+		msg.Flags, ok = readByte(&remaining)
+		if !ok {
+			return nil, false
+		}
+	}
+
 	if msg.Type != MessageTypeGet && msg.Type != MessageTypeSet && msg.Type != MessageTypeSync {
 		return nil, false
 	}
@@ -142,40 +293,60 @@ func decodeMessage(data []byte) (*Message, bool) {
 		return nil, false
 	}
 
-	if msg.Type == MessageTypeSync || msg.Type == MessageTypeSet {
-
-		msg.Value, ok = readValue(&remaining)
+	if msg.Flags&FlagFragment != 0 {
+		msg.fragment, ok = readFragment(&remaining)
 		if !ok {
 			return nil, false
 		}
+		return msg, true
+	}
 
-		if msg.Type == MessageTypeSync {
+	if !decodeBody(msg, remaining) {
+		return nil, false
+	}
 
-			metadataCount, ok := readByte(&remaining)
-			if !ok {
-				return nil, false
-			}
+	return msg, true
+}
+
+func decodeBody(msg *Message, body []byte) bool {
 
-			msg.Metadata = make(map[string]string, metadataCount)
+	if msg.Flags&FlagCompressed != 0 {
+		var ok bool
+		body, ok = decompressBody(body)
+		if !ok {
+			return false
+		}
+	}
 
-			for j := 0; j < int(metadataCount); j++ {
+	return readBody(msg, &body)
+}
 
-				key, ok := readString(&remaining)
-				if !ok {
-					return nil, false
-				}
+func readBody(msg *Message, remaining *[]byte) bool {
 
-				val, ok := readString(&remaining)
-				if !ok {
-					return nil, false
-				}
+	var ok bool
 
-				msg.Metadata[key] = val
-			}
+	if msg.Type == MessageTypeSync || msg.Type == MessageTypeSet {
+
+		msg.Value, ok = readValue(remaining)
+		if !ok {
+			return false
+		}
 
+		if msg.Type == MessageTypeSync {
+			msg.Metadata, ok = readMetadata(remaining)
+			if !ok {
+				return false
+			}
 		}
 
 	}
 
-	return msg, true
+	if msg.Type == MessageTypeGet && len(*remaining) > 0 {
+		msg.Metadata, ok = readMetadata(remaining)
+		if !ok {
+			return false
+		}
+	}
+
+	return true
 }
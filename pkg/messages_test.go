@@ -0,0 +1,303 @@
+package surp
+
+import (
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encode(t testing.TB, msg *Message, features Capabilities) [][]byte {
+	encoded, err := encodeMessage(msg, features)
+	require.NoError(t, err)
+	return encoded
+}
+
+func decodeEncoded(t *testing.T, datagrams [][]byte) *Message {
+	require.Len(t, datagrams, 1)
+	encoded := datagrams[0]
+	require.Equal(t, magicString, string(encoded[:4]))
+	msg, ok := decodeMessage(encoded[4:])
+	require.True(t, ok)
+	return msg
+}
+
+func TestMessageLegacyFormat(t *testing.T) {
+
+	encoded := encode(t, &Message{
+		SequenceNumber: 7,
+		Type:           MessageTypeSync,
+		Group:          "g",
+		Name:           "r",
+		Value:          NewDefined([]byte{1, 2}),
+		Metadata:       map[string]string{"type": "int"},
+	}, LocalCapabilities)
+
+	require.Equal(t, byte(MessageTypeSync), encoded[0][4])
+
+	msg := decodeEncoded(t, encoded)
+	require.Equal(t, byte(0), msg.Version)
+	require.Equal(t, uint16(7), msg.SequenceNumber)
+	require.Equal(t, "r", msg.Name)
+	require.Equal(t, []byte{1, 2}, msg.Value.Get())
+	require.Equal(t, "int", msg.Metadata["type"])
+}
+
+func TestMessageVersion1(t *testing.T) {
+
+	message := &Message{
+		Flags: 0x80,
+		Type:  MessageTypeSet,
+		Group: "g",
+		Name:  "r",
+		Value: NewUndefined[[]byte](),
+	}
+
+	legacy := encode(t, message, Capabilities{})
+	require.Equal(t, byte(MessageTypeSet), legacy[0][4])
+
+	encoded := encode(t, message, LocalCapabilities)
+	require.Equal(t, byte(1<<versionShift|MessageTypeSet), encoded[0][4])
+
+	msg := decodeEncoded(t, encoded)
+	require.Equal(t, byte(1), msg.Version)
+	require.Equal(t, byte(0x80), msg.Flags)
+	require.True(t, msg.Value.IsUndefined())
+
+	encoded[0][4] = 0x0F<<versionShift | MessageTypeSet
+	_, ok := decodeMessage(encoded[0][4:])
+	require.False(t, ok)
+}
+
+func TestGetCapabilities(t *testing.T) {
+
+	legacy := decodeEncoded(t, encode(t, &Message{Type: MessageTypeGet, Group: "g", Name: "r"}, nil))
+	require.Nil(t, legacy.Metadata)
+
+	msg := decodeEncoded(t, encode(t, &Message{
+		Type:     MessageTypeGet,
+		Group:    "g",
+		Name:     "r",
+		Metadata: map[string]string{MetadataCapabilities: "v1,other"},
+	}, nil))
+	require.True(t, ParseCapabilities(msg.Metadata[MetadataCapabilities]).Has(CapabilityVersion1))
+
+	peers := newPeerTable()
+	multicast := stringToMulticastAddr("g")
+	newPeer := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 1000}
+	oldPeer := &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 1000}
+
+	require.False(t, peers.features(multicast).Has(CapabilityVersion1))
+
+	peers.update(newPeer, msg.Metadata)
+	require.True(t, peers.features(newPeer).Has(CapabilityVersion1))
+	require.False(t, peers.features(newPeer).Has("other"))
+
+	// multicast stays on version 0 unless enabled
+	require.False(t, peers.features(multicast).Has(CapabilityVersion1))
+	peers.setMulticast(true)
+	require.True(t, peers.features(multicast).Has(CapabilityVersion1))
+
+	// own messages do not count
+	self := &net.UDPAddr{IP: net.ParseIP("fe80::3"), Port: 1000}
+	peers.setSelf(self)
+	peers.update(self, legacy.Metadata)
+	require.True(t, peers.features(multicast).Has(CapabilityVersion1))
+
+	peers.update(oldPeer, legacy.Metadata)
+	require.False(t, peers.features(oldPeer).Has(CapabilityVersion1))
+	require.False(t, peers.features(multicast).Has(CapabilityVersion1))
+
+	// legacy peers are never forgotten, other peers which left are
+	peers.mutex.Lock()
+	for key, p := range peers.peers {
+		p.seen = time.Now().Add(-2 * SyncTimeout)
+		peers.peers[key] = p
+	}
+	peers.mutex.Unlock()
+	require.False(t, peers.features(multicast).Has(CapabilityVersion1))
+	require.False(t, peers.features(newPeer).Has(CapabilityVersion1))
+	require.Len(t, peers.peers, 1)
+}
+
+func TestCapabilitiesNotInMetadata(t *testing.T) {
+
+	group, _ := newTestGroup()
+
+	synced := make(chan map[string]string, 1)
+	group.OnSync(func(msg *Message) {
+		synced <- msg.Metadata
+	})
+
+	deliver(group, &Message{
+		Type:     MessageTypeSync,
+		Name:     "r",
+		Metadata: map[string]string{MetadataType: "int", MetadataCapabilities: "v1"},
+	})
+	require.Equal(t, map[string]string{MetadataType: "int"}, <-synced)
+	require.True(t, group.peers.features(&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 1000}).Has(CapabilityVersion1))
+}
+
+func TestFragmentation(t *testing.T) {
+
+	// random value, so that compression does not avoid fragmentation
+	value := make([]byte, 3000)
+	rand.New(rand.NewSource(1)).Read(value)
+
+	message := &Message{
+		SequenceNumber: 3,
+		Type:           MessageTypeSync,
+		Group:          "g",
+		Name:           "r",
+		Value:          NewDefined(value),
+		Metadata:       map[string]string{"type": "string"},
+	}
+
+	require.Len(t, encode(t, message, NewCapabilities(CapabilityVersion1)), 1)
+
+	fragments := encode(t, message, LocalCapabilities)
+	require.Greater(t, len(fragments), 1)
+
+	r := newReassembler()
+	addr := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 1000}
+
+	// fragments may arrive in any order
+	for i := len(fragments) - 1; i >= 0; i-- {
+		require.LessOrEqual(t, len(fragments[i]), MaxMessageSize)
+
+		msg, ok := decodeMessage(fragments[i][4:])
+		require.True(t, ok)
+		require.NotNil(t, msg.fragment)
+
+		complete, ok := r.add(addr, msg)
+		if i > 0 {
+			require.False(t, ok)
+			continue
+		}
+		require.True(t, ok)
+		require.Equal(t, value, complete.Value.Get())
+		require.Equal(t, "string", complete.Metadata["type"])
+	}
+
+	require.Empty(t, r.pending)
+	require.Zero(t, r.size)
+
+	msg, ok := decodeMessage(fragments[0][4:])
+	require.True(t, ok)
+	_, ok = r.add(addr, msg)
+	require.False(t, ok)
+	require.Len(t, r.pending, 1)
+
+	r.expire(time.Now().Add(FragmentTimeout + time.Second))
+	require.Empty(t, r.pending)
+	require.Zero(t, r.size)
+}
+
+func TestMaxValueSize(t *testing.T) {
+
+	value := make([]byte, MaxValueSize)
+	rand.New(rand.NewSource(1)).Read(value)
+
+	message := &Message{Type: MessageTypeSync, Group: "g", Name: "r", Value: NewDefined(value), Metadata: map[string]string{"type": "bytes"}}
+
+	r := newReassembler()
+	addr := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 1000}
+
+	var complete *Message
+	for _, fragment := range encode(t, message, LocalCapabilities) {
+		msg, ok := decodeMessage(fragment[4:])
+		require.True(t, ok)
+		complete, ok = r.add(addr, msg)
+	}
+	require.NotNil(t, complete)
+	require.Equal(t, value, complete.Value.Get())
+
+	// length 0xFFFF would be decoded as undefined value
+	message.Value = NewDefined(make([]byte, MaxValueSize+1))
+	_, err := encodeMessage(message, LocalCapabilities)
+	require.Error(t, err)
+}
+
+func TestMetadataSize(t *testing.T) {
+
+	message := &Message{Type: MessageTypeSync, Group: "g", Name: "r", Metadata: map[string]string{"description": strings.Repeat("x", MaxStringSize)}}
+	decoded := decodeEncoded(t, encode(t, message, nil))
+	require.Equal(t, message.Metadata, decoded.Metadata)
+
+	// one byte lengths would wrap
+	message.Metadata["description"] += "x"
+	_, err := encodeMessage(message, nil)
+	require.Error(t, err)
+}
+
+func metadataHeavySync() *Message {
+	return &Message{
+		SequenceNumber: 1,
+		Type:           MessageTypeSync,
+		Group:          "greenhouse",
+		Name:           "config",
+		Value:          NewDefined([]byte(`{"zones":[{"name":"north","target":21.5,"hysteresis":0.5},{"name":"south","target":21.5,"hysteresis":0.5}]}`)),
+		Metadata: map[string]string{
+			"type":        "string",
+			"rw":          "true",
+			"description": "Configuration of heating zones of the greenhouse, see the documentation of the controller",
+			"unit":        "",
+			"device":      "greenhouse-controller",
+			"caps":        "deflate,frag,v1",
+		},
+	}
+}
+
+func TestCompression(t *testing.T) {
+
+	message := metadataHeavySync()
+
+	plain := encode(t, message, NewCapabilities(CapabilityVersion1))
+	compressed := encode(t, message, LocalCapabilities)
+	require.Less(t, len(compressed[0]), len(plain[0]))
+
+	msg := decodeEncoded(t, compressed)
+	require.NotZero(t, msg.Flags&FlagCompressed)
+	require.Equal(t, message.Value.Get(), msg.Value.Get())
+	require.Equal(t, message.Metadata, msg.Metadata)
+
+	// incompressible bodies are sent as they are
+	small := decodeEncoded(t, encode(t, &Message{Type: MessageTypeSet, Group: "g", Name: "r", Value: NewDefined([]byte{1})}, LocalCapabilities))
+	require.Zero(t, small.Flags)
+	require.Equal(t, []byte{1}, small.Value.Get())
+}
+
+func benchmarkEncodeSync(b *testing.B, features Capabilities) {
+	message := metadataHeavySync()
+	size := 0
+	for i := 0; i < b.N; i++ {
+		size = len(encode(b, message, features)[0])
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
+
+func BenchmarkEncodeSyncPlain(b *testing.B) {
+	benchmarkEncodeSync(b, NewCapabilities(CapabilityVersion1))
+}
+
+func BenchmarkEncodeSyncDeflate(b *testing.B) {
+	benchmarkEncodeSync(b, LocalCapabilities)
+}
+
+func benchmarkDecodeSync(b *testing.B, features Capabilities) {
+	encoded := encode(b, metadataHeavySync(), features)[0]
+	for i := 0; i < b.N; i++ {
+		decodeMessage(encoded[4:])
+	}
+}
+
+func BenchmarkDecodeSyncPlain(b *testing.B) {
+	benchmarkDecodeSync(b, NewCapabilities(CapabilityVersion1))
+}
+
+func BenchmarkDecodeSyncDeflate(b *testing.B) {
+	benchmarkDecodeSync(b, LocalCapabilities)
+}
@@ -0,0 +1,300 @@
+package surp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard metadata keys, keys of particular types are declared along with them (e.g. MetadataEnum).
+const (
+	MetadataType        = "type"
+	MetadataRW          = "rw"
+	MetadataDescription = "description"
+	MetadataUnit        = "unit"
+	MetadataPrecision   = "precision"
+	MetadataTTL         = "ttl"
+	MetadataDevice      = "device"
+	MetadataSince       = "since"
+)
+
+// Order of standard keys in Keys.
+var standardKeys = []string{
+	MetadataType,
+	MetadataRW,
+	MetadataDescription,
+	MetadataUnit,
+	MetadataMin,
+	MetadataMax,
+	MetadataStep,
+	MetadataPrecision,
+	MetadataEnum,
+	MetadataTTL,
+	MetadataDevice,
+	MetadataSince,
+}
+
+/*
+Metadata of a register, with typed accessors of standard keys:
+
+  - type: register type, e.g. "int"
+  - rw: "true" if the register is writable
+  - description: human readable description
+  - unit: unit of the value, e.g. "°C"
+  - min, max, step: numeric range constraint
+  - precision: number of decimal digits the value is meaningful to
+  - enum: comma separated symbols of enum registers
+  - ttl: duration the value is valid for, e.g. "10s"
+  - device: name of the device providing the register
+  - since: time the value is valid since, in RFC3339
+
+Custom keys are kept as they are. Getters of typed keys return undefined or zero values
+if the key is missing or invalid, use Validate to check the values.
+Setters modify the metadata in place and return it for chaining.
+*/
+type Metadata map[string]string
+
+func (md Metadata) Type() string {
+	return md[MetadataType]
+}
+
+func (md Metadata) SetType(typ string) Metadata {
+	md[MetadataType] = typ
+	return md
+}
+
+func (md Metadata) RW() bool {
+	return md[MetadataRW] == "true"
+}
+
+func (md Metadata) SetRW(rw bool) Metadata {
+	md[MetadataRW] = strconv.FormatBool(rw)
+	return md
+}
+
+func (md Metadata) Description() string {
+	return md[MetadataDescription]
+}
+
+func (md Metadata) SetDescription(description string) Metadata {
+	md[MetadataDescription] = description
+	return md
+}
+
+func (md Metadata) Unit() string {
+	return md[MetadataUnit]
+}
+
+func (md Metadata) SetUnit(unit string) Metadata {
+	md[MetadataUnit] = unit
+	return md
+}
+
+func (md Metadata) Min() Optional[float64] {
+	v, _ := md.float(MetadataMin)
+	return v
+}
+
+func (md Metadata) SetMin(min float64) Metadata {
+	md[MetadataMin] = strconv.FormatFloat(min, 'g', -1, 64)
+	return md
+}
+
+func (md Metadata) Max() Optional[float64] {
+	v, _ := md.float(MetadataMax)
+	return v
+}
+
+func (md Metadata) SetMax(max float64) Metadata {
+	md[MetadataMax] = strconv.FormatFloat(max, 'g', -1, 64)
+	return md
+}
+
+func (md Metadata) Step() Optional[float64] {
+	v, _ := md.float(MetadataStep)
+	return v
+}
+
+func (md Metadata) SetStep(step float64) Metadata {
+	md[MetadataStep] = strconv.FormatFloat(step, 'g', -1, 64)
+	return md
+}
+
+func (md Metadata) Precision() Optional[int] {
+	v, _ := md.precision()
+	return v
+}
+
+func (md Metadata) SetPrecision(precision int) Metadata {
+	md[MetadataPrecision] = strconv.Itoa(precision)
+	return md
+}
+
+func (md Metadata) Enum() []string {
+	symbols, err := ParseEnumSymbols(md[MetadataEnum])
+	if err != nil {
+		return nil
+	}
+	return symbols
+}
+
+func (md Metadata) SetEnum(symbols ...string) Metadata {
+	md[MetadataEnum] = strings.Join(symbols, ",")
+	return md
+}
+
+func (md Metadata) TTL() Optional[time.Duration] {
+	v, _ := md.ttl()
+	return v
+}
+
+func (md Metadata) SetTTL(ttl time.Duration) Metadata {
+	md[MetadataTTL] = ttl.String()
+	return md
+}
+
+func (md Metadata) Device() string {
+	return md[MetadataDevice]
+}
+
+func (md Metadata) SetDevice(device string) Metadata {
+	md[MetadataDevice] = device
+	return md
+}
+
+func (md Metadata) Since() Optional[time.Time] {
+	v, _ := md.since()
+	return v
+}
+
+func (md Metadata) SetSince(since time.Time) Metadata {
+	md[MetadataSince] = since.Format(time.RFC3339Nano)
+	return md
+}
+
+// Returns error describing all standard keys with invalid values and keys or values too long to be sent.
+func (md Metadata) Validate() error {
+	var errs []error
+
+	for _, key := range md.Keys() {
+		if len(key) > MaxStringSize || len(md[key]) > MaxStringSize {
+			errs = append(errs, fmt.Errorf("%s exceeds %d bytes", key, MaxStringSize))
+		}
+	}
+
+	if rw, ok := md[MetadataRW]; ok && rw != "true" && rw != "false" {
+		errs = append(errs, fmt.Errorf("invalid %s: %s", MetadataRW, rw))
+	}
+
+	for _, key := range []string{MetadataMin, MetadataMax, MetadataStep} {
+		if _, err := md.float(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if min, max := md.Min(), md.Max(); min.IsDefined() && max.IsDefined() && min.Get() > max.Get() {
+		errs = append(errs, fmt.Errorf("%s %g is greater than %s %g", MetadataMin, min.Get(), MetadataMax, max.Get()))
+	}
+
+	if step := md.Step(); step.IsDefined() && step.Get() <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", MetadataStep))
+	}
+
+	if _, err := md.precision(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, ok := md[MetadataEnum]; ok {
+		if _, err := ParseEnumSymbols(md[MetadataEnum]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", MetadataEnum, err))
+		}
+	}
+
+	if _, err := md.ttl(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := md.since(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns keys with standard keys first, in the order they are documented, followed by sorted custom keys.
+func (md Metadata) Keys() []string {
+	keys := make([]string, 0, len(md))
+	for _, key := range standardKeys {
+		if _, ok := md[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	var custom []string
+	for key := range md {
+		if !slices.Contains(standardKeys, key) {
+			custom = append(custom, key)
+		}
+	}
+	slices.Sort(custom)
+	return append(keys, custom...)
+}
+
+// Returns copy of the metadata as plain map.
+func (md Metadata) Map() map[string]string {
+	m := make(map[string]string, len(md))
+	for k, v := range md {
+		m[k] = v
+	}
+	return m
+}
+
+func (md Metadata) float(key string) (Optional[float64], error) {
+	s, ok := md[key]
+	if !ok {
+		return NewUndefined[float64](), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return NewUndefined[float64](), fmt.Errorf("invalid %s: %s", key, s)
+	}
+	return NewDefined(f), nil
+}
+
+func (md Metadata) precision() (Optional[int], error) {
+	s, ok := md[MetadataPrecision]
+	if !ok {
+		return NewUndefined[int](), nil
+	}
+	p, err := strconv.Atoi(s)
+	if err != nil || p < 0 {
+		return NewUndefined[int](), fmt.Errorf("invalid %s: %s", MetadataPrecision, s)
+	}
+	return NewDefined(p), nil
+}
+
+func (md Metadata) ttl() (Optional[time.Duration], error) {
+	s, ok := md[MetadataTTL]
+	if !ok {
+		return NewUndefined[time.Duration](), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return NewUndefined[time.Duration](), fmt.Errorf("invalid %s: %s", MetadataTTL, s)
+	}
+	return NewDefined(d), nil
+}
+
+func (md Metadata) since() (Optional[time.Time], error) {
+	s, ok := md[MetadataSince]
+	if !ok {
+		return NewUndefined[time.Time](), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return NewUndefined[time.Time](), fmt.Errorf("invalid %s: %s", MetadataSince, s)
+	}
+	return NewDefined(t), nil
+}
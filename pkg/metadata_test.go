@@ -0,0 +1,74 @@
+package surp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+
+	since := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	md := Metadata{"vendor": "acme"}.
+		SetType("float").
+		SetRW(true).
+		SetDescription("Room temperature").
+		SetUnit("°C").
+		SetMin(-20).
+		SetMax(50.5).
+		SetStep(0.5).
+		SetPrecision(1).
+		SetTTL(10 * time.Second).
+		SetDevice("thermostat").
+		SetSince(since)
+
+	require.NoError(t, md.Validate())
+
+	require.Equal(t, "float", md.Type())
+	require.True(t, md.RW())
+	require.Equal(t, "Room temperature", md.Description())
+	require.Equal(t, "°C", md.Unit())
+	require.Equal(t, NewDefined(-20.0), md.Min())
+	require.Equal(t, NewDefined(50.5), md.Max())
+	require.Equal(t, NewDefined(0.5), md.Step())
+	require.Equal(t, NewDefined(1), md.Precision())
+	require.Equal(t, NewDefined(10*time.Second), md.TTL())
+	require.Equal(t, "thermostat", md.Device())
+	require.True(t, since.Equal(md.Since().Get()))
+	require.Nil(t, md.Enum())
+
+	require.Equal(t, map[string]string{
+		"type":        "float",
+		"rw":          "true",
+		"description": "Room temperature",
+		"unit":        "°C",
+		"min":         "-20",
+		"max":         "50.5",
+		"step":        "0.5",
+		"precision":   "1",
+		"ttl":         "10s",
+		"device":      "thermostat",
+		"since":       "2024-05-01T08:00:00Z",
+		"vendor":      "acme",
+	}, md.Map())
+
+	require.Equal(t, []string{"type", "rw", "description", "unit", "min", "max", "step", "precision", "ttl", "device", "since", "vendor"}, md.Keys())
+
+	md = Metadata{}.SetEnum("off", "auto")
+	require.Equal(t, []string{"off", "auto"}, md.Enum())
+
+	invalid := Metadata{"rw": "yes", "min": "10", "max": "x", "step": "-1", "precision": "-2", "enum": "a,a", "ttl": "soon", "since": "yesterday"}
+	err := invalid.Validate()
+	for _, key := range []string{"rw", "max", "step", "precision", "enum", "ttl", "since"} {
+		require.ErrorContains(t, err, key)
+	}
+	require.Equal(t, NewDefined(10.0), invalid.Min())
+	require.True(t, invalid.Max().IsUndefined())
+	require.True(t, invalid.TTL().IsUndefined())
+
+	require.ErrorContains(t, Metadata{"min": "5", "max": "1"}.Validate(), "greater")
+	require.ErrorContains(t, Metadata{"description": strings.Repeat("x", 256)}.Validate(), "description")
+}
@@ -55,3 +55,11 @@ func (o Optional[T]) String() string {
 	}
 	return fmt.Sprintf("%v", o.value)
 }
+
+// Compares two optionals, defined values are compared by the given function.
+func EqualOptional[T any](a, b Optional[T], equal func(T, T) bool) bool {
+	if a.defined != b.defined {
+		return false
+	}
+	return !a.defined || equal(a.value, b.value)
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	surp "github.com/burgrp/surp-go/pkg"
+)
+
+// Default timeout of computed register getters.
+const DefaultGetterTimeout = time.Second
+
+type Getter[T any] func(ctx context.Context) (T, error)
+
+type ComputedOptions struct {
+	// Duration the computed value is reused for, zero computes the value for every sync.
+	CacheTTL time.Duration
+	// Maximum duration of the getter call, DefaultGetterTimeout if zero.
+	Timeout time.Duration
+}
+
+/*
+ComputedRegister is a read-only register whose value is computed by getter
+whenever a sync is due or a Get arrives, e.g. by reading a sensor.
+
+Getter errors and getter calls exceeding the timeout are advertised as undefined value.
+The getter is given context canceled on timeout. Results, including undefined ones,
+are cached for CacheTTL, so that frequent Gets do not overload the source.
+At most one getter call runs at a time, syncs due while it runs share its result,
+so that a getter ignoring its context does not pile up further calls.
+*/
+type ComputedRegister[T any] struct {
+	name     string
+	getter   Getter[T]
+	encoder  func(T) ([]byte, error)
+	metadata map[string]string
+	options  ComputedOptions
+
+	mutex        sync.Mutex
+	cached       surp.Optional[[]byte]
+	cachedAt     time.Time
+	syncListener func()
+
+	// getter call in flight, nil if none
+	call *getterCall[T]
+}
+
+type getterCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Panics if metadata is not valid, see surp.Metadata.Validate.
+func NewComputedRegister[T any](name string, getter Getter[T], encoder surp.Encoder[T], typ string, metadata map[string]string, options ComputedOptions) *ComputedRegister[T] {
+	return newComputedRegister(name, getter, func(v T) ([]byte, error) {
+		return encoder(v), nil
+	}, typ, metadata, options)
+}
+
+func newComputedRegister[T any](name string, getter Getter[T], encoder func(T) ([]byte, error), typ string, metadata map[string]string, options ComputedOptions) *ComputedRegister[T] {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	surp.Metadata(metadata).SetType(typ).SetRW(false)
+
+	if err := surp.Metadata(metadata).Validate(); err != nil {
+		panic(fmt.Errorf("register %s: %w", name, err))
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = DefaultGetterTimeout
+	}
+
+	return &ComputedRegister[T]{
+		name:     name,
+		getter:   getter,
+		encoder:  encoder,
+		metadata: metadata,
+		options:  options,
+	}
+}
+
+func NewComputedFloatRegister(name string, getter Getter[float64], metadata map[string]string, options ComputedOptions) *ComputedRegister[float64] {
+	return NewComputedRegister(name, getter, surp.EncodeFloat, "float", metadata, options)
+}
+
+func NewComputedIntRegister(name string, getter Getter[int64], metadata map[string]string, options ComputedOptions) *ComputedRegister[int64] {
+	return NewComputedRegister(name, getter, surp.EncodeInt, "int", metadata, options)
+}
+
+func NewComputedStringRegister(name string, getter Getter[string], metadata map[string]string, options ComputedOptions) *ComputedRegister[string] {
+	return NewComputedRegister(name, getter, surp.EncodeString, "string", metadata, options)
+}
+
+func (reg *ComputedRegister[T]) GetName() string {
+	return reg.name
+}
+
+func (reg *ComputedRegister[T]) GetEncodedValue() (surp.Optional[[]byte], map[string]string) {
+	reg.mutex.Lock()
+	valid := !reg.cachedAt.IsZero() && time.Since(reg.cachedAt) < reg.options.CacheTTL
+	cached := reg.cached
+	reg.mutex.Unlock()
+
+	if !valid {
+		cached = reg.compute()
+
+		reg.mutex.Lock()
+		reg.cached = cached
+		reg.cachedAt = time.Now()
+		reg.mutex.Unlock()
+	}
+
+	return cached, surp.Metadata(reg.metadata).Map()
+}
+
+// Awaits getter call in flight or starts a new one, returns undefined value if it fails or times out.
+func (reg *ComputedRegister[T]) compute() surp.Optional[[]byte] {
+
+	reg.mutex.Lock()
+	call := reg.call
+	if call == nil {
+		call = &getterCall[T]{done: make(chan struct{})}
+		reg.call = call
+		go reg.callGetter(call)
+	}
+	reg.mutex.Unlock()
+
+	timer := time.NewTimer(reg.options.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return surp.NewUndefined[[]byte]()
+		}
+		encoded, err := reg.encoder(call.value)
+		if err != nil {
+			return surp.NewUndefined[[]byte]()
+		}
+		return surp.NewDefined(encoded)
+	case <-timer.C:
+		return surp.NewUndefined[[]byte]()
+	}
+}
+
+// Runs getter until it returns, even if callers gave up on it.
+func (reg *ComputedRegister[T]) callGetter(call *getterCall[T]) {
+	ctx, cancel := context.WithTimeout(context.Background(), reg.options.Timeout)
+	defer cancel()
+
+	call.value, call.err = reg.getter(ctx)
+
+	reg.mutex.Lock()
+	reg.call = nil
+	reg.mutex.Unlock()
+	close(call.done)
+}
+
+// Computed registers are read-only.
+func (reg *ComputedRegister[T]) SetEncodedValue(surp.Optional[[]byte]) {
+}
+
+func (reg *ComputedRegister[T]) Attach(syncListener func()) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.syncListener = syncListener
+}
+
+// Drops cached value and syncs newly computed value, e.g. when the source signals a change.
+func (reg *ComputedRegister[T]) Invalidate() {
+	reg.mutex.Lock()
+	reg.cachedAt = time.Time{}
+	syncListener := reg.syncListener
+	reg.mutex.Unlock()
+
+	if syncListener != nil {
+		syncListener()
+	}
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"math"
+	"time"
+
+	surp "github.com/burgrp/surp-go/pkg"
+)
+
+/*
+SyncFilter limits syncs triggered by value changes, e.g. of a noisy sensor.
+
+A change is within the deadband if it differs from the last synced value by no more than Absolute
+or by no more than Relative times the last synced value, zero disables the respective band.
+Changes within the deadband do not trigger sync, significant changes are synced at most once per MinInterval.
+Filtered values are still stored, so periodic syncs and Gets carry the exact latest value.
+Changes from or to undefined value are always significant.
+*/
+type SyncFilter struct {
+	Absolute    float64
+	Relative    float64
+	MinInterval time.Duration
+}
+
+// Counters of value changes of a register, see SyncFilter.
+type SyncStats struct {
+	// Changes passed to SyncValue.
+	Changes uint64
+	// Syncs triggered by changes, immediately or after MinInterval.
+	ChangeSyncs uint64
+	// Changes within the deadband, left to the next sync.
+	Suppressed uint64
+	// Changes postponed by MinInterval, coalesced into one sync.
+	Deferred uint64
+}
+
+// Filters syncs triggered by value changes of the register.
+func Filter[T surp.Number](reg *Register[T], filter SyncFilter) *Register[T] {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	reg.minInterval = filter.MinInterval
+	reg.significant = func(old, new T) bool {
+		o, n := float64(old), float64(new)
+		d := math.Abs(n - o)
+		if math.IsNaN(d) {
+			return true
+		}
+		return d > filter.Absolute && d > filter.Relative*math.Abs(o)
+	}
+
+	return reg
+}
+
+func (reg *Register[T]) Stats() SyncStats {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return reg.stats
+}
+
+// Decides whether the change to value triggers sync now, must be called with the lock held.
+func (reg *Register[T]) filterChange(value surp.Optional[T]) bool {
+	reg.stats.Changes++
+
+	if reg.significant != nil && value.IsDefined() && reg.synced.IsDefined() && !reg.significant(reg.synced.Get(), value.Get()) {
+		reg.stats.Suppressed++
+		return false
+	}
+
+	if reg.minInterval > 0 {
+		if wait := reg.minInterval - time.Since(reg.lastChangeSync); wait > 0 {
+			reg.stats.Deferred++
+			if reg.deferred == nil {
+				reg.deferred = time.AfterFunc(wait, reg.syncDeferred)
+			}
+			return false
+		}
+		reg.lastChangeSync = time.Now()
+	}
+
+	reg.stats.ChangeSyncs++
+	return true
+}
+
+// Syncs the latest value after changes were postponed by MinInterval.
+func (reg *Register[T]) syncDeferred() {
+	reg.mutex.Lock()
+	reg.deferred = nil
+	reg.lastChangeSync = time.Now()
+	reg.stats.ChangeSyncs++
+	syncListener := reg.syncListener
+	reg.mutex.Unlock()
+
+	if syncListener != nil {
+		syncListener()
+	}
+}
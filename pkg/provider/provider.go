@@ -1,37 +1,84 @@
 package provider
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
 
 	surp "github.com/burgrp/surp-go/pkg"
 )
 
-type Register[T comparable] struct {
+/*
+Register provides value of type T to the group.
+
+Register is safe for concurrent use: application goroutines call SyncValue, GetValue and SetMetadata,
+while the group calls GetEncodedValue from its sync goroutine and SetEncodedValue from its dispatcher goroutines.
+Listeners are called without internal lock held, so they may call methods of the register.
+Sets are delivered in order, a slow set listener delays only further sets of the same register.
+*/
+type Register[T any] struct {
 	name         string
 	value        surp.Optional[T]
-	encoder      surp.Encoder[T]
+	encoder      func(T) ([]byte, error)
 	decoder      surp.Decoder[T]
+	equal        func(T, T) bool
 	rw           bool
 	metadata     map[string]string
 	setListener  SetListener[T]
 	syncListener func()
+	constrain    func(T) (T, error)
+	store        surp.Store
+	mutex        sync.Mutex
+
+	// sync filtering, see SyncFilter
+	significant    func(old, new T) bool
+	minInterval    time.Duration
+	synced         surp.Optional[T]
+	lastChangeSync time.Time
+	deferred       *time.Timer
+	stats          SyncStats
 }
 
 type SetListener[T any] func(surp.Optional[T])
 
-func NewRegister[T comparable](name string, value surp.Optional[T], encoder surp.Encoder[T], decoder surp.Decoder[T], typ string, rw bool, metadata map[string]string, setListener SetListener[T]) *Register[T] {
+// Panics if metadata is not valid, see surp.Metadata.Validate.
+func NewRegister[T any](name string, value surp.Optional[T], encoder surp.Encoder[T], decoder surp.Decoder[T], typ string, rw bool, metadata map[string]string, setListener SetListener[T]) *Register[T] {
+	return NewRegisterWithEqual(name, value, encoder, decoder, nil, typ, rw, metadata, setListener)
+}
+
+// Creates register which uses the given function to detect value changes in SyncValue.
+// If equal is nil, values of comparable types are compared by ==, other values by their encoded form.
+func NewRegisterWithEqual[T any](name string, value surp.Optional[T], encoder surp.Encoder[T], decoder surp.Decoder[T], equal func(T, T) bool, typ string, rw bool, metadata map[string]string, setListener SetListener[T]) *Register[T] {
+	return newRegister(name, value, func(v T) ([]byte, error) {
+		return encoder(v), nil
+	}, decoder, equal, typ, rw, metadata, setListener)
+}
+
+func newRegister[T any](name string, value surp.Optional[T], encoder func(T) ([]byte, error), decoder surp.Decoder[T], equal func(T, T) bool, typ string, rw bool, metadata map[string]string, setListener SetListener[T]) *Register[T] {
 	if metadata == nil {
 		metadata = map[string]string{}
 	}
 
-	metadata["type"] = typ
-	metadata["rw"] = fmt.Sprintf("%t", rw)
+	if equal == nil {
+		equal = surp.DefaultEqual(encoder)
+	}
+
+	surp.Metadata(metadata).SetType(typ).SetRW(rw)
+
+	// invalid metadata could not be synced
+	if err := surp.Metadata(metadata).Validate(); err != nil {
+		panic(fmt.Errorf("register %s: %w", name, err))
+	}
 
 	reg := &Register[T]{
 		name:        name,
 		value:       value,
 		encoder:     encoder,
 		decoder:     decoder,
+		equal:       equal,
 		metadata:    metadata,
 		rw:          rw,
 		setListener: setListener,
@@ -44,48 +91,239 @@ func (reg *Register[T]) GetName() string {
 	return reg.name
 }
 
+// Returns copy of the register metadata.
+func (reg *Register[T]) GetMetadata() surp.Metadata {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return surp.Metadata(reg.metadata).Map()
+}
+
 func (reg *Register[T]) GetValue() surp.Optional[T] {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
 	return reg.value
 }
 
 func (reg *Register[T]) Attach(syncListener func()) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
 	reg.syncListener = syncListener
 }
 
 func (reg *Register[T]) SetEncodedValue(encodedValue surp.Optional[[]byte]) {
-	if !reg.rw && reg.setListener != nil {
+	reg.mutex.Lock()
+	setListener := reg.setListener
+	constrain := reg.constrain
+	reg.mutex.Unlock()
+
+	if !reg.rw || setListener == nil {
 		return
 	}
 
 	decodedValue := surp.NewUndefined[T]()
 	if encodedValue.IsDefined() {
 		ev, ok := reg.decoder(encodedValue.Get())
-		if ok {
-			decodedValue = surp.NewDefined(ev)
+		if !ok {
+			// invalid values (e.g. unknown enum index) are rejected
+			return
+		}
+		if constrain != nil {
+			var err error
+			ev, err = constrain(ev)
+			if err != nil {
+				return
+			}
+		}
+		decodedValue = surp.NewDefined(ev)
+	}
+
+	setListener(decodedValue)
+}
+
+/*
+Records changes of the value by SyncValue to the store and restores the last one when the register is added to a group.
+Sets are recorded once the set listener accepts them by SyncValue, so that rejected sets are not restored.
+Values are synced even if the store fails to save them, wrap the store to report its errors.
+*/
+func (reg *Register[T]) Persist(store surp.Store) *Register[T] {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.store = store
+	return reg
+}
+
+// Sets value stored by Persist and passes it to the set listener, as if it was set over the network.
+func (reg *Register[T]) Restore() {
+	reg.mutex.Lock()
+	store := reg.store
+	setListener := reg.setListener
+	reg.mutex.Unlock()
+
+	if store == nil {
+		return
+	}
+
+	encoded, ok := store.Load(reg.name)
+	if !ok {
+		return
+	}
+
+	value := surp.NewUndefined[T]()
+	if encoded.IsDefined() {
+		v, ok := reg.decoder(encoded.Get())
+		if !ok {
+			// e.g. type of the register changed
+			return
 		}
+		value = surp.NewDefined(v)
 	}
 
-	reg.setListener(decodedValue)
+	reg.mutex.Lock()
+	reg.value = value
+	reg.mutex.Unlock()
+
+	if setListener != nil {
+		setListener(value)
+	}
 }
 
-func (reg *Register[T]) SyncValue(value surp.Optional[T]) {
-	if value != reg.value {
+// Constrains values set over the network and advertises the constraint in metadata.
+// Calling it again replaces the constraint and syncs the new limits.
+func Constrain[T surp.Number](reg *Register[T], constraint surp.Constraint[T]) *Register[T] {
+	reg.mutex.Lock()
+	for _, key := range constraintMetadataKeys {
+		delete(reg.metadata, key)
+	}
+	constraint.Advertise(reg.metadata)
+	reg.constrain = constraint.Apply
+	syncListener := reg.syncListener
+	reg.mutex.Unlock()
+
+	if syncListener != nil {
+		syncListener()
+	}
+	return reg
+}
+
+// Metadata keys describing encoding of the value, which is fixed when the register is created.
+var encodingMetadataKeys = []string{surp.MetadataType, surp.MetadataRW, surp.MetadataEnum, surp.MetadataScale, surp.MetadataOffset, surp.MetadataSchema}
+
+// Metadata keys advertising the constraint, which is changed by Constrain only.
+var constraintMetadataKeys = []string{surp.MetadataMin, surp.MetadataMax, surp.MetadataStep, surp.MetadataClamp}
+
+/*
+Replaces metadata of the register, e.g. description or unit, and syncs it immediately.
+
+Keys describing encoding of the value (type, rw, enum, scale, offset and schema) can not be changed,
+they are added if missing. The same holds for limits of constrained registers, see Constrain.
+Returns error if they differ or the metadata is not valid.
+*/
+func (reg *Register[T]) SetMetadata(metadata map[string]string) error {
+	return reg.UpdateMetadata(func(md surp.Metadata) {
+		clear(md)
+		for k, v := range metadata {
+			md[k] = v
+		}
+	})
+}
+
+// Changes metadata of the register by the update function and syncs it immediately, see SetMetadata.
+// The update function is given a copy, which is discarded if the result is rejected.
+func (reg *Register[T]) UpdateMetadata(update func(surp.Metadata)) error {
+	reg.mutex.Lock()
+
+	var md surp.Metadata = surp.Metadata(reg.metadata).Map()
+	update(md)
+
+	fixed := encodingMetadataKeys
+	if reg.constrain != nil {
+		fixed = slices.Concat(encodingMetadataKeys, constraintMetadataKeys)
+	}
+
+	for _, key := range fixed {
+		old, wasSet := reg.metadata[key]
+		new, isSet := md[key]
+		if !isSet && wasSet {
+			md[key] = old
+		} else if new != old {
+			reg.mutex.Unlock()
+			return fmt.Errorf("metadata key %s of register %s can not be changed", key, reg.name)
+		}
+	}
+
+	if err := md.Validate(); err != nil {
+		reg.mutex.Unlock()
+		return err
+	}
+
+	reg.metadata = md
+	syncListener := reg.syncListener
+	reg.mutex.Unlock()
+
+	if syncListener != nil {
+		syncListener()
+	}
+	return nil
+}
+
+// Returns error and keeps the previous value if the value can not be encoded,
+// e.g. scaled value out of range of its wire type.
+func (reg *Register[T]) SyncValue(value surp.Optional[T]) error {
+	if value.IsDefined() {
+		if _, err := reg.encoder(value.Get()); err != nil {
+			return fmt.Errorf("register %s: %w", reg.name, err)
+		}
+	}
+
+	reg.mutex.Lock()
+	changed := !surp.EqualOptional(value, reg.value, reg.equal)
+	notify := false
+	if changed {
 		reg.value = value
-		if reg.syncListener != nil {
-			reg.syncListener()
+		notify = reg.filterChange(value)
+		// saved with the lock held, so that the last change is stored last
+		if reg.store != nil {
+			reg.store.Save(reg.name, reg.encode(value))
 		}
 	}
+	syncListener := reg.syncListener
+	reg.mutex.Unlock()
+
+	// the group reads the value by GetEncodedValue, so the lock must not be held
+	if notify && syncListener != nil {
+		syncListener()
+	}
+	return nil
 }
 
 func (reg *Register[T]) GetEncodedValue() (surp.Optional[[]byte], map[string]string) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return reg.encode(reg.value), surp.Metadata(reg.metadata).Map()
+}
 
-	value := surp.NewUndefined[[]byte]()
+// Records value sent by sync, the deadband of Filter is measured from it.
+func (reg *Register[T]) Synced(value surp.Optional[[]byte]) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
 
-	if reg.value.IsDefined() {
-		value = surp.NewDefined(reg.encoder(reg.value.Get()))
+	reg.synced = surp.NewUndefined[T]()
+	if value.IsDefined() {
+		if v, ok := reg.decoder(value.Get()); ok {
+			reg.synced = surp.NewDefined(v)
+		}
 	}
+}
 
-	return value, reg.metadata
+// Values which can not be encoded (e.g. initial value, since SyncValue rejects them) are encoded as undefined.
+func (reg *Register[T]) encode(value surp.Optional[T]) surp.Optional[[]byte] {
+	if value.IsDefined() {
+		encoded, err := reg.encoder(value.Get())
+		if err == nil {
+			return surp.NewDefined(encoded)
+		}
+	}
+	return surp.NewUndefined[[]byte]()
 }
 
 func NewStringRegister(name string, value surp.Optional[string], rw bool, metadata map[string]string, listener SetListener[string]) *Register[string] {
@@ -104,13 +342,167 @@ func NewFloatRegister(name string, value surp.Optional[float64], rw bool, metada
 	return NewRegister[float64](name, value, surp.EncodeFloat, surp.DecodeFloat, "float", rw, metadata, listener)
 }
 
+func NewInt8Register(name string, value surp.Optional[int8], rw bool, metadata map[string]string, listener SetListener[int8]) *Register[int8] {
+	return NewRegister[int8](name, value, surp.EncodeInt8, surp.DecodeInt8, "int8", rw, metadata, listener)
+}
+
+func NewInt16Register(name string, value surp.Optional[int16], rw bool, metadata map[string]string, listener SetListener[int16]) *Register[int16] {
+	return NewRegister[int16](name, value, surp.EncodeInt16, surp.DecodeInt16, "int16", rw, metadata, listener)
+}
+
+func NewInt32Register(name string, value surp.Optional[int32], rw bool, metadata map[string]string, listener SetListener[int32]) *Register[int32] {
+	return NewRegister[int32](name, value, surp.EncodeInt32, surp.DecodeInt32, "int32", rw, metadata, listener)
+}
+
+func NewUint8Register(name string, value surp.Optional[uint8], rw bool, metadata map[string]string, listener SetListener[uint8]) *Register[uint8] {
+	return NewRegister[uint8](name, value, surp.EncodeUint8, surp.DecodeUint8, "uint8", rw, metadata, listener)
+}
+
+func NewUint16Register(name string, value surp.Optional[uint16], rw bool, metadata map[string]string, listener SetListener[uint16]) *Register[uint16] {
+	return NewRegister[uint16](name, value, surp.EncodeUint16, surp.DecodeUint16, "uint16", rw, metadata, listener)
+}
+
+func NewUint32Register(name string, value surp.Optional[uint32], rw bool, metadata map[string]string, listener SetListener[uint32]) *Register[uint32] {
+	return NewRegister[uint32](name, value, surp.EncodeUint32, surp.DecodeUint32, "uint32", rw, metadata, listener)
+}
+
+func NewUint64Register(name string, value surp.Optional[uint64], rw bool, metadata map[string]string, listener SetListener[uint64]) *Register[uint64] {
+	return NewRegister[uint64](name, value, surp.EncodeUint64, surp.DecodeUint64, "uint64", rw, metadata, listener)
+}
+
+func NewFloat32Register(name string, value surp.Optional[float32], rw bool, metadata map[string]string, listener SetListener[float32]) *Register[float32] {
+	return NewRegister[float32](name, value, surp.EncodeFloat32, surp.DecodeFloat32, "float32", rw, metadata, listener)
+}
+
+func NewBytesRegister(name string, value surp.Optional[[]byte], rw bool, metadata map[string]string, listener SetListener[[]byte]) *Register[[]byte] {
+	return NewRegisterWithEqual(name, value, surp.EncodeBytes, surp.DecodeBytes, bytes.Equal, "bytes", rw, metadata, listener)
+}
+
+func NewTimeRegister(name string, value surp.Optional[time.Time], rw bool, metadata map[string]string, listener SetListener[time.Time]) *Register[time.Time] {
+	// times out of range are rejected by SyncValue
+	return newRegister(name, value, surp.EncodeTime, surp.DecodeTime, time.Time.Equal, "time", rw, metadata, listener)
+}
+
+func NewDurationRegister(name string, value surp.Optional[time.Duration], rw bool, metadata map[string]string, listener SetListener[time.Duration]) *Register[time.Duration] {
+	return NewRegister[time.Duration](name, value, surp.EncodeDuration, surp.DecodeDuration, "duration", rw, metadata, listener)
+}
+
+func NewArrayRegister[T comparable](name string, value surp.Optional[[]T], elemType string, rw bool, metadata map[string]string, listener SetListener[[]T]) *Register[[]T] {
+	return newRegister(name, value, func(v []T) ([]byte, error) {
+		return surp.EncodeArray(v, elemType)
+	}, func(b []byte) ([]T, bool) {
+		return surp.DecodeArray[T](b, elemType)
+	}, slices.Equal[[]T], elemType+surp.ArrayTypeSuffix, rw, metadata, listener)
+}
+
+func NewIntArrayRegister(name string, value surp.Optional[[]int64], rw bool, metadata map[string]string, listener SetListener[[]int64]) *Register[[]int64] {
+	return NewArrayRegister(name, value, "int", rw, metadata, listener)
+}
+
+func NewFloatArrayRegister(name string, value surp.Optional[[]float64], rw bool, metadata map[string]string, listener SetListener[[]float64]) *Register[[]float64] {
+	return NewArrayRegister(name, value, "float", rw, metadata, listener)
+}
+
+func NewBoolArrayRegister(name string, value surp.Optional[[]bool], rw bool, metadata map[string]string, listener SetListener[[]bool]) *Register[[]bool] {
+	return NewArrayRegister(name, value, "bool", rw, metadata, listener)
+}
+
+func NewStringArrayRegister(name string, value surp.Optional[[]string], rw bool, metadata map[string]string, listener SetListener[[]string]) *Register[[]string] {
+	return NewArrayRegister(name, value, "string", rw, metadata, listener)
+}
+
 func NewAnyRegister(name string, value surp.Optional[any], typ string, rw bool, metadata map[string]string, listener SetListener[any]) *Register[any] {
 
-	reg := NewRegister[any](name, value, func(value any) []byte {
-		return surp.EncodeGeneric(value, typ)
-	}, func(b []byte) (any, bool) {
-		return surp.DecodeGeneric(b, typ)
-	}, typ, rw, metadata, listener)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata["type"] = typ
+
+	// codec of some types (e.g. struct) is described by other metadata keys
+	codec, err := surp.ResolveCodec(metadata)
+
+	encoder := func(value any) ([]byte, error) {
+		if err != nil {
+			return nil, err
+		}
+		return codec.Encode(value)
+	}
+
+	reg := newRegister[any](name, value, encoder, func(b []byte) (any, bool) {
+		if err != nil {
+			return nil, false
+		}
+		return codec.Decode(b)
+	}, nil, typ, rw, metadata, listener)
 
 	return reg
 }
+
+// Creates register with one of the given symbols as value.
+// Panics if the symbols are not valid enum.
+func NewEnumRegister(name string, value surp.Optional[string], symbols []string, rw bool, metadata map[string]string, listener SetListener[string]) *Register[string] {
+
+	if err := surp.ValidateEnumSymbols(symbols); err != nil {
+		panic(err)
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	surp.Metadata(metadata).SetEnum(symbols...)
+
+	return newRegister(name, value, func(v string) ([]byte, error) {
+		return surp.EncodeEnum(v, symbols)
+	}, func(b []byte) (string, bool) {
+		return surp.DecodeEnum(b, symbols)
+	}, nil, "enum", rw, metadata, listener)
+}
+
+// Creates register of float64 engineering value, sent as raw integer of wireType, value = raw * scale + offset.
+// Panics if the wire type can not be scaled.
+func NewScaledRegister(name string, value surp.Optional[float64], wireType string, scale float64, offset float64, rw bool, metadata map[string]string, listener SetListener[float64]) *Register[float64] {
+
+	if err := surp.ValidateScaled(wireType, scale, offset); err != nil {
+		panic(err)
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	surp.AdvertiseScale(metadata, scale, offset)
+
+	encoder := func(v float64) ([]byte, error) {
+		return surp.EncodeScaled(v, wireType, scale, offset)
+	}
+
+	// changes below the resolution do not trigger syncs
+	return newRegister(name, value, encoder, func(b []byte) (float64, bool) {
+		return surp.DecodeScaled(b, wireType, scale, offset)
+	}, surp.EqualEncoded(encoder), wireType, rw, metadata, listener)
+}
+
+func NewJSONRegister[T any](name string, value surp.Optional[T], rw bool, metadata map[string]string, listener SetListener[T]) *Register[T] {
+	return newRegister(name, value, surp.EncodeJSON[T], surp.DecodeJSON[T], nil, "json", rw, metadata, listener)
+}
+
+// Creates register of self-describing value, e.g. map[string]any with nested arrays.
+func NewCBORRegister(name string, value surp.Optional[any], rw bool, metadata map[string]string, listener SetListener[any]) *Register[any] {
+	return newRegister(name, value, surp.EncodeCBOR, surp.DecodeCBOR, nil, "cbor", rw, metadata, listener)
+}
+
+// Creates register of struct type T, with schema derived from the struct fields and their surp tags.
+// Panics if the struct can not be described by schema.
+func NewStructRegister[T any](name string, value surp.Optional[T], rw bool, metadata map[string]string, listener SetListener[T]) *Register[T] {
+
+	schema, err := surp.SchemaOf(reflect.TypeFor[T]())
+	if err != nil {
+		panic(err)
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[surp.MetadataSchema] = schema.String()
+
+	return newRegister(name, value, surp.EncodeStruct[T], surp.DecodeStruct[T], nil, "struct", rw, metadata, listener)
+}
@@ -0,0 +1,468 @@
+package provider_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	surp "github.com/burgrp/surp-go/pkg"
+	"github.com/burgrp/surp-go/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonComparableValue(t *testing.T) {
+
+	reg := provider.NewJSONRegister("map", surp.NewDefined(map[string]int{"a": 1}), false, nil, nil)
+
+	syncs := 0
+	reg.Attach(func() {
+		syncs++
+	})
+
+	reg.SyncValue(surp.NewDefined(map[string]int{"a": 1}))
+	require.Equal(t, 0, syncs)
+
+	reg.SyncValue(surp.NewDefined(map[string]int{"a": 2}))
+	require.Equal(t, 1, syncs)
+
+	reg.SyncValue(surp.NewUndefined[map[string]int]())
+	require.Equal(t, 2, syncs)
+}
+
+func TestRejectedSets(t *testing.T) {
+
+	var sets []surp.Optional[int64]
+	reg := provider.NewIntRegister("counter", surp.NewDefined(int64(1)), true, nil, func(value surp.Optional[int64]) {
+		sets = append(sets, value)
+	})
+
+	// malformed value does not unset the register
+	reg.SetEncodedValue(surp.NewDefined([]byte{1, 2, 3}))
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeInt(2)))
+	reg.SetEncodedValue(surp.NewUndefined[[]byte]())
+	require.Equal(t, []surp.Optional[int64]{surp.NewDefined(int64(2)), surp.NewUndefined[int64]()}, sets)
+
+	// read-only registers and registers without listener ignore sets
+	provider.NewIntRegister("ro", surp.NewDefined(int64(1)), false, nil, nil).SetEncodedValue(surp.NewDefined(surp.EncodeInt(2)))
+	provider.NewIntRegister("rw", surp.NewDefined(int64(1)), true, nil, nil).SetEncodedValue(surp.NewDefined(surp.EncodeInt(2)))
+}
+
+func TestCustomEqual(t *testing.T) {
+
+	type sample struct {
+		Values []float64
+		Note   string
+	}
+
+	// only values matter, notes do not trigger syncs
+	reg := provider.NewRegisterWithEqual("sample", surp.NewDefined(sample{Values: []float64{1}}), func(v sample) []byte {
+		return nil
+	}, func(b []byte) (sample, bool) {
+		return sample{}, false
+	}, func(a, b sample) bool {
+		return len(a.Values) == len(b.Values) && (len(a.Values) == 0 || a.Values[0] == b.Values[0])
+	}, "sample", false, nil, nil)
+
+	syncs := 0
+	reg.Attach(func() {
+		syncs++
+	})
+
+	reg.SyncValue(surp.NewDefined(sample{Values: []float64{1}, Note: "x"}))
+	require.Equal(t, 0, syncs)
+
+	reg.SyncValue(surp.NewDefined(sample{Values: []float64{2}}))
+	require.Equal(t, 1, syncs)
+}
+
+func TestEnumRejectsInvalidSet(t *testing.T) {
+
+	var sets []surp.Optional[string]
+	reg := provider.NewEnumRegister("mode", surp.NewDefined("off"), []string{"off", "auto", "manual"}, true, nil, func(value surp.Optional[string]) {
+		sets = append(sets, value)
+	})
+
+	encoded, metadata := reg.GetEncodedValue()
+	require.Equal(t, surp.NewDefined([]byte{0}), encoded)
+	require.Equal(t, "off,auto,manual", metadata[surp.MetadataEnum])
+
+	reg.SetEncodedValue(surp.NewDefined([]byte{2}))
+	reg.SetEncodedValue(surp.NewDefined([]byte{3}))
+	reg.SetEncodedValue(surp.NewDefined([]byte{0, 1}))
+	reg.SetEncodedValue(surp.NewUndefined[[]byte]())
+	require.Equal(t, []surp.Optional[string]{surp.NewDefined("manual"), surp.NewUndefined[string]()}, sets)
+
+	// invalid value is rejected
+	require.Error(t, reg.SyncValue(surp.NewDefined("on")))
+	encoded, _ = reg.GetEncodedValue()
+	require.Equal(t, surp.NewDefined([]byte{0}), encoded)
+
+	// symbols must fit in metadata value
+	var long []string
+	for i := 0; i < 50; i++ {
+		long = append(long, "symbol"+strconv.Itoa(i))
+	}
+	require.Panics(t, func() {
+		provider.NewEnumRegister("long", surp.NewUndefined[string](), long, false, nil, nil)
+	})
+
+	// advertised symbols would be split differently
+	require.Panics(t, func() {
+		provider.NewEnumRegister("comma", surp.NewDefined("c"), []string{"a,b", "c"}, false, nil, nil)
+	})
+}
+
+func TestInvalidMetadata(t *testing.T) {
+
+	// metadata which could not be synced is rejected when the register is built
+	require.Panics(t, func() {
+		provider.NewFloatRegister("setpoint", surp.NewDefined(20.0), true, map[string]string{surp.MetadataMin: "x"}, nil)
+	})
+	require.Panics(t, func() {
+		provider.NewComputedIntRegister("counter", func(context.Context) (int64, error) {
+			return 0, nil
+		}, map[string]string{surp.MetadataDescription: strings.Repeat("x", surp.MaxStringSize+1)}, provider.ComputedOptions{})
+	})
+}
+
+func TestConstrainedSet(t *testing.T) {
+
+	var sets []surp.Optional[float64]
+	reg := provider.Constrain(provider.NewFloatRegister("setpoint", surp.NewDefined(20.0), true, nil, func(value surp.Optional[float64]) {
+		sets = append(sets, value)
+	}), surp.Constraint[float64]{Min: surp.NewDefined(5.0), Max: surp.NewDefined(30.0)})
+
+	_, metadata := reg.GetEncodedValue()
+	require.Equal(t, "5", metadata[surp.MetadataMin])
+	require.Equal(t, "30", metadata[surp.MetadataMax])
+
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeFloat(31)))
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeFloat(22)))
+	require.Equal(t, []surp.Optional[float64]{surp.NewDefined(22.0)}, sets)
+}
+
+func TestScaledRegister(t *testing.T) {
+
+	reg := provider.NewScaledRegister("temp", surp.NewDefined(21.5), "int16", 0.1, 0, false, nil, nil)
+
+	encoded, metadata := reg.GetEncodedValue()
+	require.Equal(t, surp.NewDefined(surp.EncodeInt16(215)), encoded)
+	require.Equal(t, "int16", metadata["type"])
+	require.Equal(t, "0.1", metadata[surp.MetadataScale])
+
+	syncs := 0
+	reg.Attach(func() {
+		syncs++
+	})
+
+	reg.SyncValue(surp.NewDefined(21.51))
+	require.Equal(t, 0, syncs)
+
+	reg.SyncValue(surp.NewDefined(21.6))
+	require.Equal(t, 1, syncs)
+
+	// values out of range are rejected
+	require.Error(t, reg.SyncValue(surp.NewDefined(5000.0)))
+	require.Equal(t, surp.NewDefined(21.6), reg.GetValue())
+	require.Equal(t, 1, syncs)
+}
+
+// Run with -race to detect unsynchronized access.
+func TestConcurrentAccess(t *testing.T) {
+
+	var sets atomic.Int64
+	var reg *provider.Register[int64]
+	reg = provider.NewIntRegister("counter", surp.NewDefined[int64](0), true, nil, func(value surp.Optional[int64]) {
+		sets.Add(1)
+		// listeners may call the register
+		reg.SyncValue(value)
+	})
+
+	var syncs atomic.Int64
+	reg.Attach(func() {
+		syncs.Add(1)
+		reg.GetEncodedValue()
+	})
+
+	const n = 1000
+	var undefined atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(4)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			reg.SyncValue(surp.NewDefined(int64(i)))
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			value, metadata := reg.GetEncodedValue()
+			if !value.IsDefined() {
+				undefined.Add(1)
+			}
+			metadata["local"] = "modified"
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			reg.SetEncodedValue(surp.NewDefined(surp.EncodeInt(int64(-i))))
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			reg.GetValue()
+			reg.GetMetadata()
+		}
+	}()
+
+	wg.Wait()
+
+	require.Zero(t, undefined.Load())
+	require.Equal(t, int64(n), sets.Load())
+	require.Positive(t, syncs.Load())
+	require.NotContains(t, reg.GetMetadata(), "local")
+}
+
+func TestComputedRegister(t *testing.T) {
+
+	calls := 0
+	var result error
+	reg := provider.NewComputedFloatRegister("temp", func(ctx context.Context) (float64, error) {
+		calls++
+		if result != nil {
+			return 0, result
+		}
+		return float64(calls), nil
+	}, map[string]string{"unit": "°C"}, provider.ComputedOptions{CacheTTL: time.Hour})
+
+	value, metadata := reg.GetEncodedValue()
+	require.Equal(t, surp.NewDefined(surp.EncodeFloat(1)), value)
+	require.Equal(t, "float", metadata["type"])
+	require.Equal(t, "false", metadata["rw"])
+
+	// cached
+	value, _ = reg.GetEncodedValue()
+	require.Equal(t, surp.NewDefined(surp.EncodeFloat(1)), value)
+	require.Equal(t, 1, calls)
+
+	syncs := 0
+	reg.Attach(func() {
+		syncs++
+	})
+
+	result = errors.New("sensor not ready")
+	reg.Invalidate()
+	require.Equal(t, 1, syncs)
+	value, _ = reg.GetEncodedValue()
+	require.True(t, value.IsUndefined())
+	require.Equal(t, 2, calls)
+}
+
+func TestComputedRegisterTimeout(t *testing.T) {
+
+	canceled := make(chan struct{})
+	reg := provider.NewComputedIntRegister("slow", func(ctx context.Context) (int64, error) {
+		<-ctx.Done()
+		close(canceled)
+		return 1, nil
+	}, nil, provider.ComputedOptions{Timeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	value, _ := reg.GetEncodedValue()
+	require.True(t, value.IsUndefined())
+	require.Less(t, time.Since(start), time.Second)
+	<-canceled
+}
+
+func TestComputedRegisterHungGetter(t *testing.T) {
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	reg := provider.NewComputedIntRegister("hung", func(ctx context.Context) (int64, error) {
+		// ignores context
+		calls.Add(1)
+		<-release
+		return 1, nil
+	}, nil, provider.ComputedOptions{Timeout: 10 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reg.GetEncodedValue()
+		}()
+	}
+	wg.Wait()
+
+	value, _ := reg.GetEncodedValue()
+	require.True(t, value.IsUndefined())
+	require.Equal(t, int64(1), calls.Load())
+
+	// the released call is either shared or followed by a new one
+	close(release)
+	value, _ = reg.GetEncodedValue()
+	require.True(t, value.IsDefined())
+	require.LessOrEqual(t, calls.Load(), int64(2))
+}
+
+func TestPersistentRegister(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "values.json")
+	store, err := surp.OpenFileStore(path, 0)
+	require.NoError(t, err)
+
+	// the application accepts values up to 25
+	var reg *provider.Register[int64]
+	reg = provider.Constrain(provider.NewIntRegister("setpoint", surp.NewDefined[int64](20), true, nil, func(value surp.Optional[int64]) {
+		if value.IsDefined() && value.Get() <= 25 {
+			reg.SyncValue(value)
+		}
+	}), surp.Constraint[int64]{Max: surp.NewDefined[int64](30), Policy: surp.ClampOutOfRange}).Persist(store)
+
+	// nothing stored yet
+	reg.Restore()
+	require.Equal(t, surp.NewDefined[int64](20), reg.GetValue())
+
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeInt(24)))
+
+	// clamped to 30 and rejected by the application, so not stored
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeInt(35)))
+	require.Equal(t, surp.NewDefined[int64](24), reg.GetValue())
+	require.NoError(t, store.Close())
+
+	store, err = surp.OpenFileStore(path, 0)
+	require.NoError(t, err)
+
+	var restored []surp.Optional[int64]
+	reg = provider.NewIntRegister("setpoint", surp.NewDefined[int64](20), true, nil, func(value surp.Optional[int64]) {
+		restored = append(restored, value)
+	}).Persist(store)
+
+	reg.Restore()
+	require.Equal(t, surp.NewDefined[int64](24), reg.GetValue())
+	require.Equal(t, []surp.Optional[int64]{surp.NewDefined[int64](24)}, restored)
+}
+
+func TestFilteredRegister(t *testing.T) {
+
+	// interval long enough not to elapse during the test
+	reg := provider.Filter(provider.NewFloatRegister("temperature", surp.NewDefined(20.0), false, nil, nil),
+		provider.SyncFilter{Absolute: 0.5, MinInterval: time.Hour})
+
+	// as done by the group
+	sync := func() surp.Optional[[]byte] {
+		value, _ := reg.GetEncodedValue()
+		reg.Synced(value)
+		return value
+	}
+
+	syncs := make(chan surp.Optional[[]byte], 10)
+	reg.Attach(func() {
+		syncs <- sync()
+	})
+	sync()
+
+	// within deadband, the value is still readable, reads do not move the deadband
+	reg.SyncValue(surp.NewDefined(20.3))
+	require.Len(t, syncs, 0)
+	value, _ := reg.GetEncodedValue()
+	require.Equal(t, surp.NewDefined(surp.EncodeFloat(20.3)), value)
+
+	reg.SyncValue(surp.NewDefined(20.6))
+	require.Equal(t, surp.NewDefined(surp.EncodeFloat(20.6)), <-syncs)
+
+	reg.SyncValue(surp.NewDefined(21.0))
+
+	// significant changes within the interval are deferred
+	reg.SyncValue(surp.NewDefined(22.0))
+	reg.SyncValue(surp.NewDefined(23.0))
+	require.Len(t, syncs, 0)
+
+	require.Equal(t, provider.SyncStats{Changes: 5, ChangeSyncs: 1, Suppressed: 2, Deferred: 2}, reg.Stats())
+}
+
+func TestFilteredRegisterCoalesces(t *testing.T) {
+
+	reg := provider.Filter(provider.NewIntRegister("counter", surp.NewDefined[int64](0), false, nil, nil),
+		provider.SyncFilter{MinInterval: 20 * time.Millisecond})
+
+	var mutex sync.Mutex
+	var last surp.Optional[[]byte]
+	reg.Attach(func() {
+		value, _ := reg.GetEncodedValue()
+		mutex.Lock()
+		defer mutex.Unlock()
+		last = value
+	})
+
+	// deferred changes are synced as the latest one
+	for i := int64(1); i <= 3; i++ {
+		reg.SyncValue(surp.NewDefined(i))
+	}
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return surp.EqualOptional(last, surp.NewDefined(surp.EncodeInt(3)), bytes.Equal)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSetMetadata(t *testing.T) {
+
+	var sets []surp.Optional[float64]
+	reg := provider.Constrain(provider.NewFloatRegister("setpoint", surp.NewDefined(20.0), true, nil, func(value surp.Optional[float64]) {
+		sets = append(sets, value)
+	}), surp.Constraint[float64]{Min: surp.NewDefined(5.0), Max: surp.NewDefined(30.0)})
+
+	syncs := 0
+	reg.Attach(func() {
+		syncs++
+	})
+
+	require.NoError(t, reg.UpdateMetadata(func(md surp.Metadata) {
+		md.SetUnit("°C")
+	}))
+	require.Equal(t, 1, syncs)
+
+	_, metadata := reg.GetEncodedValue()
+	require.Equal(t, "°C", metadata[surp.MetadataUnit])
+	require.Equal(t, "float", metadata[surp.MetadataType])
+
+	// encoding and limits can not be changed, rejected metadata is not synced
+	require.Error(t, reg.SetMetadata(map[string]string{surp.MetadataType: "int"}))
+	require.Error(t, reg.UpdateMetadata(func(md surp.Metadata) {
+		md.SetMax(40)
+	}))
+	require.Error(t, reg.SetMetadata(map[string]string{surp.MetadataUnit: "°C", surp.MetadataMin: "x"}))
+	require.Equal(t, 1, syncs)
+
+	// limits are kept and still enforced
+	require.NoError(t, reg.SetMetadata(map[string]string{surp.MetadataDescription: "Room setpoint"}))
+	require.Equal(t, 2, syncs)
+	require.Equal(t, surp.Metadata{surp.MetadataType: "float", surp.MetadataRW: "true", surp.MetadataDescription: "Room setpoint",
+		surp.MetadataMin: "5", surp.MetadataMax: "30"}, reg.GetMetadata())
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeFloat(35)))
+	require.Empty(t, sets)
+
+	// the constraint is changed by Constrain, which syncs the new limits
+	provider.Constrain(reg, surp.Constraint[float64]{Max: surp.NewDefined(40.0)})
+	require.Equal(t, 3, syncs)
+	require.Equal(t, surp.Metadata{surp.MetadataType: "float", surp.MetadataRW: "true", surp.MetadataDescription: "Room setpoint",
+		surp.MetadataMax: "40"}, reg.GetMetadata())
+	reg.SetEncodedValue(surp.NewDefined(surp.EncodeFloat(35)))
+	require.Equal(t, []surp.Optional[float64]{surp.NewDefined(35.0)}, sets)
+}
@@ -0,0 +1,145 @@
+package surp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Metadata keys of fixed-point scaled registers.
+const (
+	MetadataScale  = "scale"
+	MetadataOffset = "offset"
+)
+
+/*
+Scaled Encoding:
+
+	Registers of integer type with "scale" or "offset" metadata keys carry engineering values
+	as raw integers of their type, value = raw * scale + offset.
+	Values are rounded to the nearest raw integer, halfway values away from zero.
+	Values out of range of the integer type can not be encoded.
+
+e.g. temperature 21.5 °C with type "int16" and scale "0.1" is sent as 215.
+*/
+
+var scalableTypes = map[string]bool{
+	"int":    true,
+	"int8":   true,
+	"int16":  true,
+	"int32":  true,
+	"uint8":  true,
+	"uint16": true,
+	"uint32": true,
+	"uint64": true,
+}
+
+func EncodeScaled(v float64, typ string, scale float64, offset float64) ([]byte, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("value %g can not be encoded as scaled %s", v, typ)
+	}
+
+	raw := math.Round((v - offset) / scale)
+
+	// float64(MaxInt64) and float64(MaxUint64) round up, so the upper bounds are exclusive
+	if raw < math.MinInt64 || raw >= math.MaxUint64 || (typ != "uint64" && raw >= math.MaxInt64) {
+		return nil, fmt.Errorf("value %g out of range of %s with scale %g and offset %g", v, typ, scale, offset)
+	}
+
+	var rawValue any = int64(raw)
+	if raw >= 0 {
+		rawValue = uint64(raw)
+	}
+
+	encoded, err := EncodeGeneric(rawValue, typ)
+	if err != nil {
+		return nil, fmt.Errorf("value %g out of range of %s with scale %g and offset %g", v, typ, scale, offset)
+	}
+	return encoded, nil
+}
+
+func DecodeScaled(b []byte, typ string, scale float64, offset float64) (float64, bool) {
+	raw, ok := DecodeGeneric(b, typ)
+	if !ok {
+		return 0, false
+	}
+	f, ok := toFloat64(raw)
+	if !ok {
+		return 0, false
+	}
+	return f*scale + offset, true
+}
+
+// Returns scale and offset advertised in metadata and whether the register is scaled.
+func ParseScale(metadata map[string]string) (float64, float64, bool, error) {
+	s, hasScale := metadata[MetadataScale]
+	o, hasOffset := metadata[MetadataOffset]
+	if !hasScale && !hasOffset {
+		return 1, 0, false, nil
+	}
+
+	scale, offset := 1.0, 0.0
+	var err error
+
+	if hasScale {
+		scale, err = strconv.ParseFloat(s, 64)
+		if err != nil || scale == 0 || math.IsInf(scale, 0) {
+			return 0, 0, false, fmt.Errorf("invalid scale: %s", s)
+		}
+	}
+
+	if hasOffset {
+		offset, err = strconv.ParseFloat(o, 64)
+		if err != nil || math.IsInf(offset, 0) {
+			return 0, 0, false, fmt.Errorf("invalid offset: %s", o)
+		}
+	}
+
+	return scale, offset, true, nil
+}
+
+// Returns error if values of the type can not be scaled.
+func ValidateScaled(typ string, scale float64, offset float64) error {
+	if !scalableTypes[typ] {
+		return fmt.Errorf("type %s can not be scaled", typ)
+	}
+	if scale == 0 || math.IsNaN(scale) || math.IsInf(scale, 0) {
+		return fmt.Errorf("invalid scale: %g", scale)
+	}
+	if math.IsNaN(offset) || math.IsInf(offset, 0) {
+		return fmt.Errorf("invalid offset: %g", offset)
+	}
+	return nil
+}
+
+// Writes scale and offset to metadata.
+func AdvertiseScale(metadata map[string]string, scale float64, offset float64) {
+	metadata[MetadataScale] = strconv.FormatFloat(scale, 'g', -1, 64)
+	if offset != 0 {
+		metadata[MetadataOffset] = strconv.FormatFloat(offset, 'g', -1, 64)
+	}
+}
+
+func scaledCodec(typ string, scale float64, offset float64) (*Codec, error) {
+
+	if err := ValidateScaled(typ, scale, offset); err != nil {
+		return nil, err
+	}
+
+	return &Codec{
+		Encode: func(v any) ([]byte, error) {
+			f, ok := toFloat64(v)
+			if !ok {
+				return nil, typeError(v, "scaled "+typ)
+			}
+			return EncodeScaled(f, typ, scale, offset)
+		},
+		Decode: func(b []byte) (any, bool) {
+			return DecodeScaled(b, typ, scale, offset)
+		},
+		Parse: func(s string) (any, error) {
+			return strconv.ParseFloat(s, 64)
+		},
+		Format: formatAny,
+	}, nil
+}
@@ -0,0 +1,176 @@
+package surp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store keeps encoded register values across restarts.
+type Store interface {
+	// Returns stored value of the register and whether there is one.
+	Load(name string) (Optional[[]byte], bool)
+	// Stores value of the register, returns error if it could not be written.
+	Save(name string, value Optional[[]byte]) error
+}
+
+// Providers implementing Restorer restore their value when added to a group, before being attached.
+type Restorer interface {
+	Restore()
+}
+
+// Default delay of FileStore writes, so that bursts of sets are written at once.
+const DefaultFlushDelay = time.Second
+
+/*
+FileStore is a Store backed by JSON file mapping register names to base64 encoded values (null if undefined).
+
+The file is replaced atomically by writing a temporary file and renaming it,
+so that a crash during write does not lose previously stored values. The file keeps its mode.
+Saves are written after flush delay, Close writes pending saves.
+*/
+type FileStore struct {
+	path       string
+	flushDelay time.Duration
+
+	mutex   sync.Mutex
+	values  map[string]*[]byte
+	pending *time.Timer
+	err     error
+}
+
+// Opens store at path, which is created on first flush if it does not exist.
+// Zero flush delay writes the file on every save.
+func OpenFileStore(path string, flushDelay time.Duration) (*FileStore, error) {
+	store := &FileStore{
+		path:       path,
+		flushDelay: flushDelay,
+		values:     map[string]*[]byte{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, &store.values); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func (store *FileStore) Load(name string) (Optional[[]byte], bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	value, ok := store.values[name]
+	if !ok {
+		return NewUndefined[[]byte](), false
+	}
+	if value == nil {
+		return NewUndefined[[]byte](), true
+	}
+	return NewDefined(*value), true
+}
+
+// Returns error of the write with zero flush delay, otherwise error of previous failed write.
+func (store *FileStore) Save(name string, value Optional[[]byte]) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if value.IsDefined() {
+		v := value.Get()
+		store.values[name] = &v
+	} else {
+		store.values[name] = nil
+	}
+
+	if store.flushDelay == 0 {
+		store.err = store.write()
+		return store.err
+	}
+
+	if store.pending == nil {
+		store.pending = time.AfterFunc(store.flushDelay, func() {
+			store.Flush()
+		})
+	}
+	return store.err
+}
+
+// Writes pending saves, returns error of this or previous failed write.
+func (store *FileStore) Flush() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.pending != nil {
+		store.pending.Stop()
+		store.pending = nil
+		store.err = store.write()
+	}
+
+	return store.err
+}
+
+func (store *FileStore) Close() error {
+	return store.Flush()
+}
+
+// Writes values to the file, must be called with the lock held.
+func (store *FileStore) write() error {
+	data, err := json.MarshalIndent(store.values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// temporary files are created with 0600
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(store.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(store.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(store.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// data must be on disk before rename, otherwise crash may leave empty file
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), store.path); err != nil {
+		return err
+	}
+
+	// rename must be on disk too, otherwise crash may bring back the previous file
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
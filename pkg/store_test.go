@@ -0,0 +1,73 @@
+package surp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "values.json")
+
+	store, err := OpenFileStore(path, time.Hour)
+	require.NoError(t, err)
+
+	_, ok := store.Load("setpoint")
+	require.False(t, ok)
+
+	store.Save("setpoint", NewDefined(EncodeFloat(21.5)))
+	store.Save("mode", NewUndefined[[]byte]())
+
+	// debounced
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, store.Close())
+
+	reopened, err := OpenFileStore(path, 0)
+	require.NoError(t, err)
+
+	value, ok := reopened.Load("setpoint")
+	require.True(t, ok)
+	require.Equal(t, NewDefined(EncodeFloat(21.5)), value)
+
+	value, ok = reopened.Load("mode")
+	require.True(t, ok)
+	require.True(t, value.IsUndefined())
+
+	// written immediately with zero delay
+	reopened.Save("setpoint", NewDefined(EncodeFloat(22)))
+	store, err = OpenFileStore(path, 0)
+	require.NoError(t, err)
+	value, _ = store.Load("setpoint")
+	require.Equal(t, NewDefined(EncodeFloat(22)), value)
+
+	// no temporary files are left
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	// mode of the file is kept
+	require.NoError(t, os.Chmod(path, 0o640))
+	require.NoError(t, store.Save("setpoint", NewDefined(EncodeFloat(23))))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err = OpenFileStore(path, 0)
+	require.Error(t, err)
+
+	// write errors are returned
+	missing, err := OpenFileStore(filepath.Join(t.TempDir(), "missing", "values.json"), 0)
+	require.NoError(t, err)
+	require.Error(t, missing.Save("setpoint", NewDefined(EncodeFloat(21.5))))
+}
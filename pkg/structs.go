@@ -0,0 +1,431 @@
+package surp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metadata key describing layout of struct registers.
+const MetadataSchema = "schema"
+
+/*
+Struct Encoding (Binary):
+
+	Fields are encoded in the order given by the schema, using encoding of their types.
+	Variable size fields (e.g. string) are prefixed by their length as unsigned varint.
+
+Struct schema is advertised in "schema" metadata key as comma separated list of fields:
+
+	name:type[*scale]
+
+e.g. "temp:int16*0.1,humidity:uint8,label:string".
+Fields with scale are integers on the wire and floats in Go, i.e. value = raw * scale.
+
+Schema of a Go struct is derived from its exported fields and their tags:
+
+	Temp  float64 `surp:"temp,type=int16,scale=0.1"`
+	Label string  `surp:"label"`
+	Debug string  `surp:"-"`
+
+Field name defaults to Go field name and type is inferred from Go type, unless specified.
+*/
+type StructField struct {
+	Name  string
+	Type  string
+	Scale float64
+
+	index []int
+}
+
+type StructSchema []StructField
+
+// Parses surp struct tag into name, flags (e.g. "rw") and options (e.g. "scale=0.1").
+func parseTag(tag string) (string, map[string]bool, map[string]string) {
+	parts := strings.Split(tag, ",")
+	flags := map[string]bool{}
+	options := map[string]string{}
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if k, v, ok := strings.Cut(part, "="); ok {
+			options[k] = v
+		} else if part != "" {
+			flags[part] = true
+		}
+	}
+	return strings.TrimSpace(parts[0]), flags, options
+}
+
+var schemaCache sync.Map
+
+// Returns schema of the given Go struct type.
+func SchemaOf(t reflect.Type) (StructSchema, error) {
+
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(StructSchema), nil
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+
+	schema := StructSchema{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("surp")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, _, options := parseTag(tag)
+		if name == "" {
+			name = f.Name
+		}
+
+		field := StructField{
+			Name:  name,
+			Type:  options["type"],
+			index: f.Index,
+		}
+
+		if s, ok := options["scale"]; ok {
+			scale, err := strconv.ParseFloat(s, 64)
+			if err != nil || scale == 0 {
+				return nil, fmt.Errorf("invalid scale of field %s: %s", f.Name, s)
+			}
+			if field.Type == "" {
+				return nil, fmt.Errorf("scaled field %s requires explicit type", f.Name)
+			}
+			field.Scale = scale
+		}
+
+		if field.Type == "" {
+			typ, ok := typeNameOf(f.Type)
+			if !ok {
+				return nil, fmt.Errorf("unsupported type %s of field %s", f.Type, f.Name)
+			}
+			field.Type = typ
+		}
+
+		schema = append(schema, field)
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+
+	schemaCache.Store(t, schema)
+
+	return schema, nil
+}
+
+func ParseStructSchema(s string) (StructSchema, error) {
+
+	schema := StructSchema{}
+
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+
+		name, typ, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid schema field: %s", part)
+		}
+
+		field := StructField{Name: name, Type: typ}
+
+		if t, s, ok := strings.Cut(typ, "*"); ok {
+			scale, err := strconv.ParseFloat(s, 64)
+			if err != nil || scale == 0 {
+				return nil, fmt.Errorf("invalid scale of field %s: %s", name, s)
+			}
+			field.Type = t
+			field.Scale = scale
+		}
+
+		schema = append(schema, field)
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func (schema StructSchema) validate() error {
+	names := map[string]bool{}
+	for _, field := range schema {
+		if field.Name == "" || strings.ContainsAny(field.Name, ",:") {
+			return fmt.Errorf("invalid field name: %q", field.Name)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("duplicate field name: %s", field.Name)
+		}
+		names[field.Name] = true
+		if _, ok := GetCodec(field.Type); !ok {
+			return fmt.Errorf("unsupported type %s of field %s", field.Type, field.Name)
+		}
+	}
+	// schema is advertised in metadata
+	if size := len(schema.String()); size > MaxStringSize {
+		return fmt.Errorf("schema of %d bytes exceeds maximum of %d bytes", size, MaxStringSize)
+	}
+	return nil
+}
+
+func (schema StructSchema) String() string {
+	parts := make([]string, len(schema))
+	for i, field := range schema {
+		parts[i] = field.Name + ":" + field.Type
+		if field.Scale != 0 {
+			parts[i] += "*" + strconv.FormatFloat(field.Scale, 'g', -1, 64)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Encodes map of field values or a struct.
+func (schema StructSchema) Encode(v any) ([]byte, error) {
+
+	fields, ok := v.(map[string]any)
+	if !ok {
+		var err error
+		fields, err = structToMap(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, field := range schema {
+		value, ok := fields[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing field %s", field.Name)
+		}
+
+		if field.Scale != 0 {
+			f, ok := toFloat64(value)
+			if !ok {
+				return nil, typeError(value, field.Type)
+			}
+			raw := math.Round(f / field.Scale)
+			if raw < math.MinInt64 || raw >= math.MaxInt64 {
+				return nil, fmt.Errorf("value %g of field %s out of range", f, field.Name)
+			}
+			value = int64(raw)
+		}
+
+		codec, _ := GetCodec(field.Type)
+		encoded, err := codec.Encode(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		writeElement(&buf, encoded, fixedSizes[field.Type])
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decodes value into map of field values.
+func (schema StructSchema) Decode(b []byte) (map[string]any, bool) {
+
+	fields := make(map[string]any, len(schema))
+
+	for _, field := range schema {
+		encoded, ok := readElement(&b, fixedSizes[field.Type])
+		if !ok {
+			return nil, false
+		}
+
+		codec, _ := GetCodec(field.Type)
+		value, ok := codec.Decode(encoded)
+		if !ok {
+			return nil, false
+		}
+
+		if field.Scale != 0 {
+			raw, ok := toFloat64(value)
+			if !ok {
+				return nil, false
+			}
+			value = raw * field.Scale
+		}
+
+		fields[field.Name] = value
+	}
+
+	if len(b) > 0 {
+		return nil, false
+	}
+
+	return fields, true
+}
+
+// Parses JSON object with field values.
+func (schema StructSchema) Parse(s string) (map[string]any, error) {
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("struct value must be a JSON object: %w", err)
+	}
+
+	fields := make(map[string]any, len(schema))
+	for _, field := range schema {
+		r, ok := raw[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing field %s", field.Name)
+		}
+
+		str := string(r)
+		var unquoted string
+		if json.Unmarshal(r, &unquoted) == nil {
+			str = unquoted
+		}
+
+		var value any
+		var err error
+		if field.Scale != 0 {
+			value, err = strconv.ParseFloat(str, 64)
+		} else {
+			codec, _ := GetCodec(field.Type)
+			value, err = codec.Parse(str)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		fields[field.Name] = value
+	}
+
+	return fields, nil
+}
+
+// Replaces values rendered differently by their codec than by JSON (e.g. durations) with formatted strings.
+func (schema StructSchema) formatFields(fields map[string]any) map[string]any {
+	formatted := make(map[string]any, len(fields))
+	for _, field := range schema {
+		value := fields[field.Name]
+		if _, ok := value.(fmt.Stringer); ok {
+			value = FormatGeneric(value, field.Type)
+		}
+		formatted[field.Name] = value
+	}
+	return formatted
+}
+
+func structToMap(v any) (map[string]any, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("value %v can not be encoded as struct", v)
+	}
+
+	schema, err := SchemaOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]any, len(schema))
+	for _, field := range schema {
+		fields[field.Name] = rv.FieldByIndex(field.index).Interface()
+	}
+	return fields, nil
+}
+
+func EncodeStruct[T any](v T) ([]byte, error) {
+	schema, err := SchemaOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	return schema.Encode(v)
+}
+
+func DecodeStruct[T any](b []byte) (T, bool) {
+	var result T
+
+	schema, err := SchemaOf(reflect.TypeFor[T]())
+	if err != nil {
+		return result, false
+	}
+
+	fields, ok := schema.Decode(b)
+	if !ok {
+		return result, false
+	}
+
+	rv := reflect.ValueOf(&result).Elem()
+	for _, field := range schema {
+		if !setField(rv.FieldByIndex(field.index), fields[field.Name]) {
+			return result, false
+		}
+	}
+
+	return result, true
+}
+
+// Sets decoded value to a struct field, converting it to the field type.
+func setField(target reflect.Value, value any) bool {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return false
+	}
+
+	// e.g. []int64 decoded from "int[]" to []int field
+	if v.Kind() == reflect.Slice && target.Kind() == reflect.Slice && !v.Type().ConvertibleTo(target.Type()) {
+		slice := reflect.MakeSlice(target.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if !setField(slice.Index(i), v.Index(i).Interface()) {
+				return false
+			}
+		}
+		target.Set(slice)
+		return true
+	}
+
+	if !v.Type().ConvertibleTo(target.Type()) {
+		return false
+	}
+	target.Set(v.Convert(target.Type()))
+	return true
+}
+
+func init() {
+	RegisterCodecFactory("struct", func(metadata map[string]string) (*Codec, error) {
+
+		schema, err := ParseStructSchema(metadata[MetadataSchema])
+		if err != nil {
+			return nil, err
+		}
+
+		return &Codec{
+			Encode: schema.Encode,
+			Decode: func(b []byte) (any, bool) {
+				return schema.Decode(b)
+			},
+			Parse: func(s string) (any, error) {
+				return schema.Parse(s)
+			},
+			Format: func(v any) string {
+				if fields, ok := v.(map[string]any); ok {
+					v = schema.formatFields(fields)
+				}
+				b, err := json.Marshal(v)
+				if err != nil {
+					return formatAny(v)
+				}
+				return string(b)
+			},
+		}, nil
+	})
+}
@@ -32,7 +32,8 @@ Addressing Scheme:
 Message Structure (Binary):
 
 	[4 bytes]  Magic number "SURP"
-	[1 byte]  Message type
+	[1 byte]  Protocol version (upper 4 bits) and message type (lower 4 bits)
+	[1 byte]  Flags (only if version > 0)
 	[2 bytes] Sequence number
 	[1 byte]  Group name length (G)
 	[G bytes] Group name
@@ -51,6 +52,27 @@ Message Structure (Binary):
 	Sync message sets all fields.
 	Set message has no metadata and port (ends after value).
 	Get message has no value, metadata, or port (ends after register name).
+	Get message may optionally carry metadata after register name to advertise capabilities.
+
+Fragmentation:
+
+	Messages exceeding 512 bytes are split into numbered fragments (flag 0x01 of version 1 header)
+	toward peers advertising "frag" capability. Receivers reassemble them with a timeout and memory limit.
+
+Compression:
+
+	Message body (value and metadata) is deflated (flag 0x02 of version 1 header) toward peers
+	advertising "deflate" capability, whenever it reduces the message size.
+	Compression is applied before fragmentation.
+
+Versioning:
+
+	Version 0 is the original format, which is still used whenever no extension is needed.
+	Peers advertise supported extensions in "caps" metadata key of syncs and gets,
+	extensions are used only toward peers which advertised them.
+	Multicast messages use extensions only if enabled by SetMulticastExtensions.
+	The key is removed from metadata before it is passed to registers and listeners.
+	Peers not heard from for SyncTimeout are forgotten.
 
 Implementation Notes:
 1. Security model assumes protected network layer
@@ -66,6 +88,8 @@ package surp
 import (
 	"math/rand"
 	"net"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -86,6 +110,11 @@ type Provider interface {
 	Attach(syncListener func())
 }
 
+// Providers implementing SyncObserver are told values sent by their multicast syncs.
+type SyncObserver interface {
+	Synced(value Optional[[]byte])
+}
+
 type Consumer interface {
 	GetName() string
 	SetMetadata(map[string]string)
@@ -99,6 +128,7 @@ type Decoder[T any] func([]byte) (T, bool)
 type consumerWrapper struct {
 	consumer      Consumer
 	timeout       *time.Timer
+	generation    uint64
 	setIP         net.IP
 	setPort       uint16
 	multicastAddr *net.UDPAddr
@@ -107,6 +137,7 @@ type consumerWrapper struct {
 type providerWrapper struct {
 	provider      Provider
 	syncChannel   chan struct{}
+	stop          chan struct{}
 	multicastAddr *net.UDPAddr
 }
 
@@ -132,7 +163,13 @@ type RegisterGroup struct {
 	sequenceNumber      uint16
 	sequenceNumberMutex sync.Mutex
 
-	syncListener func(*Message)
+	peers       *peerTable
+	reassembler *reassembler
+	dispatcher  *dispatcher
+	budget      *syncBudget
+
+	syncListener      func(*Message)
+	sendErrorListener func(*Message, error)
 }
 
 func JoinGroup(interfaceName string, groupName string, catchAll bool) (*RegisterGroup, error) {
@@ -142,15 +179,8 @@ func JoinGroup(interfaceName string, groupName string, catchAll bool) (*Register
 		return nil, err
 	}
 
-	group := &RegisterGroup{
-		name:         groupName,
-		catchAll:     catchAll,
-		netInterface: in,
-		providers:    make(map[string]*providerWrapper),
-		consumers:    make(map[string][]*consumerWrapper),
-	}
-
-	group.multicastAddr = stringToMulticastAddr(groupName)
+	group := newRegisterGroup(groupName, catchAll)
+	group.netInterface = in
 
 	if catchAll {
 
@@ -164,16 +194,32 @@ func JoinGroup(interfaceName string, groupName string, catchAll bool) (*Register
 
 	}
 
-	group.unicastReader, group.unicastWriter, group.unicastClose, err = listenUnicast(in)
+	var localAddr *net.UDPAddr
+	group.unicastReader, group.unicastWriter, localAddr, group.unicastClose, err = listenUnicast(in)
 	if err != nil {
 		return nil, err
 	}
+	group.peers.setSelf(localAddr)
 
 	go group.readMessages(group.unicastReader)
 
 	return group, nil
 }
 
+func newRegisterGroup(groupName string, catchAll bool) *RegisterGroup {
+	return &RegisterGroup{
+		name:          groupName,
+		catchAll:      catchAll,
+		multicastAddr: stringToMulticastAddr(groupName),
+		providers:     make(map[string]*providerWrapper),
+		consumers:     make(map[string][]*consumerWrapper),
+		peers:         newPeerTable(),
+		reassembler:   newReassembler(),
+		dispatcher:    newDispatcher(DispatchWorkers, DispatchQueueSize),
+		budget:        processBudget,
+	}
+}
+
 func (group *RegisterGroup) AddProviders(providers ...Provider) error {
 
 	for _, provider := range providers {
@@ -182,7 +228,8 @@ func (group *RegisterGroup) AddProviders(providers ...Provider) error {
 
 		wrapper := &providerWrapper{
 			provider:      provider,
-			syncChannel:   make(chan struct{}),
+			syncChannel:   make(chan struct{}, 1),
+			stop:          make(chan struct{}),
 			multicastAddr: group.getFilteredMulticastAddr(name),
 		}
 
@@ -190,9 +237,11 @@ func (group *RegisterGroup) AddProviders(providers ...Provider) error {
 		group.providers[name] = wrapper
 		group.providersMutex.Unlock()
 
-		provider.Attach(func() {
-			wrapper.syncChannel <- struct{}{}
-		})
+		if restorer, ok := provider.(Restorer); ok {
+			restorer.Restore()
+		}
+
+		provider.Attach(wrapper.requestSync)
 
 		go group.syncLoop(wrapper)
 
@@ -243,26 +292,28 @@ func (group *RegisterGroup) AddConsumers(consumers ...Consumer) error {
 		group.consumers[name] = wrappers
 
 		consumer.Attach(func(value Optional[[]byte]) {
-			port := wrapper.setPort
+			group.consumersMutex.Lock()
+			ip, port := wrapper.setIP, wrapper.setPort
+			group.consumersMutex.Unlock()
+
 			if port != 0 {
-				message := &Message{
+				group.send(&Message{
 					SequenceNumber: group.nextSequenceNumber(),
 					Type:           MessageTypeSet,
 					Group:          group.name,
 					Name:           name,
 					Value:          value,
-				}
-				encoded := encodeMessage(message)
-				group.unicastWriter <- MessageAndAddr{Message: encoded, Addr: &net.UDPAddr{IP: wrapper.setIP, Port: int(wrapper.setPort)}}
+				}, &net.UDPAddr{IP: ip, Port: int(port)})
 			}
 		})
 
-		encoded := encodeMessage(&Message{
+		get := &Message{
 			SequenceNumber: group.nextSequenceNumber(),
 			Type:           MessageTypeGet,
 			Group:          group.name,
 			Name:           name,
-		})
+			Metadata:       map[string]string{MetadataCapabilities: LocalCapabilities.String()},
+		}
 
 		if !group.catchAll {
 			err := group.listenFilteredMulticast(wrapper.multicastAddr)
@@ -271,14 +322,59 @@ func (group *RegisterGroup) AddConsumers(consumers ...Consumer) error {
 			}
 		}
 
-		group.unicastWriter <- MessageAndAddr{Message: encoded, Addr: group.multicastAddr}
-		group.unicastWriter <- MessageAndAddr{Message: encoded, Addr: wrapper.multicastAddr}
+		group.send(get, group.multicastAddr)
+		group.send(get, wrapper.multicastAddr)
 	}
 
 	return nil
 }
 
+// Removes providers added by AddProviders and stops their syncs, e.g. when adding of related registers failed.
+func (group *RegisterGroup) removeProviders(providers ...Provider) {
+	group.providersMutex.Lock()
+	defer group.providersMutex.Unlock()
+
+	for _, provider := range providers {
+		name := provider.GetName()
+		if wrapper, ok := group.providers[name]; ok && wrapper.provider == provider {
+			delete(group.providers, name)
+			close(wrapper.stop)
+		}
+	}
+}
+
+// Removes consumers added by AddConsumers.
+func (group *RegisterGroup) removeConsumers(consumers ...Consumer) {
+	group.consumersMutex.Lock()
+	defer group.consumersMutex.Unlock()
+
+	for _, consumer := range consumers {
+		name := consumer.GetName()
+		// new slice, since dispatched syncs may still iterate the old one
+		var kept []*consumerWrapper
+		for _, wrapper := range group.consumers[name] {
+			if wrapper.consumer != consumer {
+				kept = append(kept, wrapper)
+				continue
+			}
+			// timeout is accessed by syncs of the register, which run in order on the dispatcher
+			group.dispatcher.dispatch("sync:"+name, func() {
+				wrapper.generation++
+				if wrapper.timeout != nil {
+					wrapper.timeout.Stop()
+				}
+			})
+		}
+		group.consumers[name] = kept
+		if len(kept) == 0 {
+			delete(group.consumers, name)
+		}
+	}
+}
+
 func (group *RegisterGroup) Close() error {
+	group.dispatcher.close()
+
 	if group.multicastClose != nil {
 		if err := group.multicastClose(); err != nil {
 			return err
@@ -310,21 +406,41 @@ func (group *RegisterGroup) readMessages(ch <-chan MessageAndAddr) {
 			continue
 		}
 
+		if message.fragment != nil {
+			message, ok = group.reassembler.add(m.Addr, message)
+			if !ok {
+				continue
+			}
+		}
+
+		// listeners are called by dispatcher, so that they do not block reading
 		switch message.Type {
 		case MessageTypeSync:
 
+			group.peers.update(m.Addr, message.Metadata)
+			delete(message.Metadata, MetadataCapabilities)
+
 			group.consumersMutex.Lock()
-			consumers := group.consumers[message.Name]
+			consumers := slices.Clone(group.consumers[message.Name])
 			for _, wrapper := range consumers {
 				wrapper.setIP = m.Addr.IP
 				wrapper.setPort = uint16(m.Addr.Port)
-				wrapper.consumer.SetMetadata(message.Metadata)
-				group.syncConsumerValue(wrapper, message.Value)
 			}
 			group.consumersMutex.Unlock()
 
-			if group.syncListener != nil {
-				group.syncListener(message)
+			if len(consumers) > 0 {
+				group.dispatcher.dispatch("sync:"+message.Name, func() {
+					for _, wrapper := range consumers {
+						wrapper.consumer.SetMetadata(message.Metadata)
+						group.syncConsumerValue(wrapper, message.Value)
+					}
+				})
+			}
+
+			if listener := group.getSyncListener(); listener != nil {
+				group.dispatcher.dispatch("listener:"+message.Name, func() {
+					listener(message)
+				})
 			}
 
 		case MessageTypeSet:
@@ -333,34 +449,71 @@ func (group *RegisterGroup) readMessages(ch <-chan MessageAndAddr) {
 			group.providersMutex.Unlock()
 
 			if providerWrapper != nil {
-				providerWrapper.provider.SetEncodedValue(message.Value)
+				group.dispatcher.dispatch("set:"+message.Name, func() {
+					providerWrapper.provider.SetEncodedValue(message.Value)
+				})
 			}
 
 		case MessageTypeGet:
+			group.peers.update(m.Addr, message.Metadata)
+			delete(message.Metadata, MetadataCapabilities)
+
 			group.providersMutex.Lock()
 			providerWrapper := group.providers[message.Name]
 			group.providersMutex.Unlock()
 
 			if providerWrapper != nil {
-				providerWrapper.syncChannel <- struct{}{}
+				providerWrapper.requestSync()
 			}
 
 		}
 	}
 }
 
+// Syncs consumer value and schedules its expiration, must be called by dispatcher.
 func (group *RegisterGroup) syncConsumerValue(wrapper *consumerWrapper, value Optional[[]byte]) {
 
+	// timeouts of earlier syncs may fire concurrently, they are ignored by generation
+	wrapper.generation++
+	generation := wrapper.generation
+
 	if wrapper.timeout != nil {
 		wrapper.timeout.Stop()
 	}
 	wrapper.timeout = time.AfterFunc(SyncTimeout, func() {
-		wrapper.consumer.SyncValue(NewUndefined[[]byte]())
+		group.dispatcher.dispatch("sync:"+wrapper.consumer.GetName(), func() {
+			if wrapper.generation == generation {
+				wrapper.consumer.SyncValue(NewUndefined[[]byte]())
+			}
+		})
 	})
 
 	wrapper.consumer.SyncValue(value)
 }
 
+// Requests sync of the provider value, requests are coalesced while a sync is pending.
+func (wrapper *providerWrapper) requestSync() {
+	select {
+	case wrapper.syncChannel <- struct{}{}:
+	default:
+	}
+}
+
+// Returns numbers of received messages dropped by register name (or "listener:" and register name for the sync listener),
+// since their listeners did not keep up.
+func (group *RegisterGroup) DroppedMessages() map[string]uint64 {
+	overflows := group.dispatcher.getOverflows()
+	dropped := make(map[string]uint64, len(overflows))
+	for key, count := range overflows {
+		kind, name, _ := strings.Cut(key, ":")
+		if kind != "sync" && kind != "set" {
+			name = key
+		}
+		dropped[name] += count
+	}
+	return dropped
+}
+
 func (group *RegisterGroup) nextSequenceNumber() uint16 {
 	group.sequenceNumberMutex.Lock()
 	defer group.sequenceNumberMutex.Unlock()
@@ -371,37 +524,106 @@ func (group *RegisterGroup) nextSequenceNumber() uint16 {
 func (group *RegisterGroup) syncLoop(providerWrapper *providerWrapper) {
 	for {
 
-		regular := time.After(MinSyncPeriod + time.Duration(rand.Intn(int(MaxSyncPeriod-MinSyncPeriod))))
+		period := MinSyncPeriod + time.Duration(rand.Intn(int(MaxSyncPeriod-MinSyncPeriod)))
+		regular := time.After(group.budget.stretchPeriod(period))
 
 		select {
 		case <-regular:
-			group.sendSyncMessage(providerWrapper)
+			group.sendSyncMessage(providerWrapper, true)
 		case <-providerWrapper.syncChannel:
-			group.sendSyncMessage(providerWrapper)
+			group.sendSyncMessage(providerWrapper, false)
+		case <-providerWrapper.stop:
+			return
 		}
 
 	}
 }
 
-func (group *RegisterGroup) sendSyncMessage(providerWrapper *providerWrapper) {
+func (group *RegisterGroup) sendSyncMessage(providerWrapper *providerWrapper, periodic bool) {
 
 	name := providerWrapper.provider.GetName()
 
-	value, metadata := providerWrapper.provider.GetEncodedValue()
+	value, providerMetadata := providerWrapper.provider.GetEncodedValue()
+
+	metadata := make(map[string]string, len(providerMetadata)+1)
+	for k, v := range providerMetadata {
+		metadata[k] = v
+	}
+	metadata[MetadataCapabilities] = LocalCapabilities.String()
 
-	encoded := encodeMessage(&Message{
+	message := &Message{
 		SequenceNumber: group.nextSequenceNumber(),
 		Type:           MessageTypeSync,
 		Group:          group.name,
 		Name:           name,
 		Value:          value,
 		Metadata:       metadata,
-	})
+	}
+
+	packets := group.send(message, group.multicastAddr)
+	packets += group.send(message, providerWrapper.multicastAddr)
+
+	if observer, ok := providerWrapper.provider.(SyncObserver); ok && packets > 0 {
+		observer.Synced(value)
+	}
 
-	group.unicastWriter <- MessageAndAddr{Message: encoded, Addr: group.multicastAddr}
-	group.unicastWriter <- MessageAndAddr{Message: encoded, Addr: providerWrapper.multicastAddr}
+	if exceeded, rate := group.budget.record(packets, periodic, time.Now()); exceeded != nil {
+		group.dispatcher.dispatch("budget", func() {
+			exceeded(rate)
+		})
+	}
+}
+
+// Sends message, returns number of packets sent.
+func (group *RegisterGroup) send(message *Message, addr *net.UDPAddr) int {
+	encoded, err := encodeMessage(message, group.peers.features(addr))
+	if err != nil {
+		// messages which can not be encoded are dropped, consumers check value size before sets
+		if listener := group.getSendErrorListener(); listener != nil {
+			group.dispatcher.dispatch("error:"+message.Name, func() {
+				listener(message, err)
+			})
+		}
+		return 0
+	}
+	for _, packet := range encoded {
+		group.unicastWriter <- MessageAndAddr{Message: packet, Addr: addr}
+	}
+	return len(encoded)
+}
+
+/*
+Enables extensions (e.g. fragmentation and deflate) in multicast messages, if all known peers support them.
+Disabled by default, since legacy peers which never send anything, e.g. pure consumers, can not be detected
+and they would drop such messages.
+*/
+func (group *RegisterGroup) SetMulticastExtensions(enabled bool) {
+	group.peers.setMulticast(enabled)
 }
 
+// Sets listener called with every received sync message,
+// calls for different registers may run concurrently.
 func (group *RegisterGroup) OnSync(listener func(*Message)) {
+	group.consumersMutex.Lock()
+	defer group.consumersMutex.Unlock()
 	group.syncListener = listener
 }
+
+func (group *RegisterGroup) getSyncListener() func(*Message) {
+	group.consumersMutex.Lock()
+	defer group.consumersMutex.Unlock()
+	return group.syncListener
+}
+
+// Sets listener called with messages which could not be sent, e.g. since their value is too long to be encoded.
+func (group *RegisterGroup) OnSendError(listener func(message *Message, err error)) {
+	group.providersMutex.Lock()
+	defer group.providersMutex.Unlock()
+	group.sendErrorListener = listener
+}
+
+func (group *RegisterGroup) getSendErrorListener() func(*Message, error) {
+	group.providersMutex.Lock()
+	defer group.providersMutex.Unlock()
+	return group.sendErrorListener
+}
@@ -69,11 +69,12 @@ func listenMulticast(netInterface *net.Interface, addr *net.UDPAddr) (<-chan Mes
 	return rcvChannel, conn.Close, nil
 }
 
-func listenUnicast(netInterface *net.Interface) (<-chan MessageAndAddr, chan<- MessageAndAddr, func() error, error) {
+// Returns also local address of the socket, which is the source address of sent messages.
+func listenUnicast(netInterface *net.Interface) (<-chan MessageAndAddr, chan<- MessageAndAddr, *net.UDPAddr, func() error, error) {
 
 	addrs, err := netInterface.Addrs()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	var ip net.IP
@@ -88,7 +89,7 @@ func listenUnicast(netInterface *net.Interface) (<-chan MessageAndAddr, chan<- M
 
 	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: ip, Zone: netInterface.Name})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	rcvChannel := make(chan MessageAndAddr)
@@ -115,5 +116,5 @@ func listenUnicast(netInterface *net.Interface) (<-chan MessageAndAddr, chan<- M
 		}
 	}()
 
-	return rcvChannel, sndChannel, conn.Close, nil
+	return rcvChannel, sndChannel, conn.LocalAddr().(*net.UDPAddr), conn.Close, nil
 }
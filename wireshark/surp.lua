@@ -8,7 +8,9 @@ local message_types = {
 
 -- Define protocol fields
 local f_magic = ProtoField.string("surp.magic", "Magic", base.ASCII)
-local f_msg_type = ProtoField.uint8("surp.msg_type", "Message Type", base.HEX, message_types)
+local f_msg_type = ProtoField.uint8("surp.msg_type", "Message Type", base.HEX, message_types, 0x0F)
+local f_version = ProtoField.uint8("surp.version", "Protocol Version", base.DEC, nil, 0xF0)
+local f_flags = ProtoField.uint8("surp.flags", "Flags", base.HEX)
 local f_seq = ProtoField.uint16("surp.seq", "Sequence Number", base.DEC)
 local f_group_len = ProtoField.uint8("surp.group_len", "Group Name Length", base.DEC)
 local f_group = ProtoField.string("surp.group", "Group Name", base.ASCII)
@@ -22,7 +24,7 @@ local f_meta_key = ProtoField.string("surp.meta_key", "Metadata Key", base.ASCII
 local f_meta_val_len = ProtoField.uint8("surp.meta_val_len", "Metadata Value Length", base.DEC)
 local f_meta_val = ProtoField.string("surp.meta_val", "Metadata Value", base.ASCII)
 
-surp_proto.fields = {f_magic, f_msg_type, f_seq, f_group_len, f_group, f_reg_name_len, f_reg_name, f_val_len,
+surp_proto.fields = {f_magic, f_msg_type, f_version, f_flags, f_seq, f_group_len, f_group, f_reg_name_len, f_reg_name, f_val_len,
                      f_val, f_meta_count, f_meta_key_len, f_meta_key, f_meta_val_len, f_meta_val}
 
 -- Main dissector function
@@ -43,10 +45,20 @@ function surp_proto.dissector(tvb, pinfo, tree)
     subtree:add(f_magic, tvb(offset, 4))
     offset = offset + 4
 
-    local msg_type = tvb(offset, 1):uint()
+    local msg_type = bit.band(tvb(offset, 1):uint(), 0x0F)
+    local version = bit.rshift(tvb(offset, 1):uint(), 4)
+    subtree:add(f_version, tvb(offset, 1))
     subtree:add(f_msg_type, tvb(offset, 1))
     offset = offset + 1
 
+    if version > 0 then
+        if tvb:len() < offset + 1 then
+            return
+        end
+        subtree:add(f_flags, tvb(offset, 1))
+        offset = offset + 1
+    end
+
     local info_str = ""
     if msg_type == 0x01 or msg_type == 0x02 or msg_type == 0x03 then
 